@@ -5,20 +5,34 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
 	cache_mux "ytproxy/cache/mux"
+	cidr "ytproxy/cidr"
 	config "ytproxy/config"
+	dlna "ytproxy/dlna"
 	extractor_mux "ytproxy/extractor/mux"
+	limiter "ytproxy/limiter"
 	logger "ytproxy/logger"
+	logger_access "ytproxy/logger/access"
 	logger_mux "ytproxy/logger/mux"
+	rotate "ytproxy/logger/rotate"
 	logic "ytproxy/logic"
+	sessions "ytproxy/sessions"
+	sign "ytproxy/sign"
 	streamer "ytproxy/streamer"
 )
 
+// isRoute checks if r is "/<name>/<link>" or "/<name>?<options>" request
+func isRoute(r *http.Request, name string) bool {
+	return strings.HasPrefix(r.RequestURI, "/"+name+"/") || r.URL.Path == "/"+name
+}
+
 // Run creates and runs all objects
 func Run(confFile string) error {
 	conf, def, opts, log, err := readConfig(confFile)
@@ -26,26 +40,73 @@ func Run(confFile string) error {
 		return fmt.Errorf("config read error: %s", err)
 
 	}
-	appLogic := logic.New(def, opts)
+	// sessions outlive config reloads, old app logic streams keep running
+	registry := sessions.New()
+	// limiter outlives them too, reload applies new limits only
+	limits := limiter.New(conf.Limits)
+	appLogic, err := newLogic(conf, def, opts, registry, limits)
+	if err != nil {
+		return fmt.Errorf("config error: %s", err)
+	}
 	shouldWait := make(chan confChan)
-	go signalsCatcher(confFile, log, shouldWait)
+	go signalsCatcher(confFile, log, registry, limits, shouldWait)
 	return httpLoop(log, conf, appLogic, shouldWait)
 }
 
-func makeServer(conf config.T, log logger.T,
-	appLogic *logic.AppLogic) *http.Server {
+func makeServer(conf config.T, log logger.T, accessLog *logger_access.T,
+	appLogic *logic.AppLogic, mediaServer *dlna.T) *http.Server {
+	// path tokens are not written to access log
+	strip := func(uri string) string {
+		if _, res, ok := conf.Tokens.PathToken(uri); ok {
+			return res
+		}
+		return uri
+	}
 	return &http.Server{
 		Addr: fmt.Sprintf("%s:%d", conf.Host, conf.PortInt),
-		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Handler: accessLog.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.RemoteAddr = cidr.RealIP(r, conf.TrustedProxies)
+			if !conf.Access.Allowed(cidr.IP(r.RemoteAddr)) {
+				log.LogInfo("Forbidden address", "addr", r.RemoteAddr, "url", r.RequestURI)
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
 			switch {
-			case strings.HasPrefix(r.RequestURI, "/play/"):
+			case isRoute(r, "play"):
 				appLogic.Run(w, r, log)
+			case isRoute(r, "hls"):
+				appLogic.HLS(w, r, log)
+			case isRoute(r, "playlist"):
+				appLogic.Playlist(w, r, log)
+			case isRoute(r, "search"):
+				appLogic.Search(w, r, log)
+			case isRoute(r, "feed"):
+				appLogic.Feed(w, r, log)
+			case isRoute(r, "info"):
+				appLogic.Info(w, r, log)
+			case isRoute(r, "thumb"):
+				appLogic.Thumbnail(w, r, log)
+			case isRoute(r, "subs"):
+				appLogic.Subtitles(w, r, log)
+			case isRoute(r, "sign"):
+				appLogic.Sign(w, r, log)
+			case isRoute(r, "admin/sessions"):
+				appLogic.Sessions(w, r, log)
+			case mediaServer != nil && strings.HasPrefix(r.RequestURI, dlna.Prefix):
+				mediaServer.ServeHTTP(w, r)
 			default:
+				if uri, template, ok := conf.Routes.Expand(r.URL); ok {
+					log.LogDebug("Route template", "template", template,
+						"url", r.RequestURI, "play", uri)
+					r.RequestURI = uri
+					appLogic.Run(w, r, log)
+					return
+				}
 				log.LogInfo("Bad request", "addr", r.RemoteAddr, "url", r.RequestURI)
 				log.LogDebug("Bad request", "req", r)
 				http.NotFound(w, r)
 			}
-		})}
+		}), strip)}
 }
 
 type confChan struct {
@@ -58,10 +119,21 @@ func httpLoop(log logger.T, conf config.T, appLogic *logic.AppLogic,
 	ch <-chan confChan) error {
 	for {
 		log.LogInfo("Starting web server", "host", conf.Host, "port", conf.PortInt)
-		s := makeServer(conf, log, appLogic)
+		mediaServer, err := dlna.New(conf.DLNA, conf.PortInt, appLogic,
+			logger_mux.NewLayer(log, "DLNA"))
+		if err != nil {
+			log.LogError("DLNA server", "error", err)
+		}
+		accessLog, err := logger_access.New(conf.Log)
+		if err != nil {
+			mediaServer.Close()
+			return fmt.Errorf("access log: %s", err)
+		}
+		s := makeServer(conf, log, accessLog, appLogic, mediaServer)
 		done := make(chan error)
 		go startHTTP(s, log, done)
 		<-ch
+		mediaServer.Close()
 		log.LogInfo("Stopping web server")
 		if err := s.Close(); err != nil {
 			log.LogInfo("Web server stopping", "error", err)
@@ -69,6 +141,9 @@ func httpLoop(log logger.T, conf config.T, appLogic *logic.AppLogic,
 		if err := s.Shutdown(context.Background()); err != nil {
 			log.LogInfo("Web server shutting down", "error", err)
 		}
+		if err := accessLog.Close(); err != nil {
+			log.LogError("access log close", "error", err)
+		}
 		if err := <-done; err != nil {
 			return err
 		}
@@ -110,8 +185,9 @@ func readConfig(confFile string) (config.T, logic.Option, []logic.Option,
 		return config.T{}, logic.Option{}, nil, nil, err
 	}
 
+	shaper := limiter.NewShaper(conf.Limits)
 	defaultAppLogic,
-		err := getNewAppLogic(log, config.SubT{
+		err := getNewAppLogic(log, shaper, config.SubT{
 		T: config.T{
 			Streamer:           conf.Streamer,
 			Extractor:          conf.Extractor,
@@ -128,7 +204,7 @@ func readConfig(confFile string) (config.T, logic.Option, []logic.Option,
 
 	optionalAppLogic := make([]logic.Option, 0)
 	for _, v := range conf.SubConfig {
-		opt, err := getNewAppLogic(log, v)
+		opt, err := getNewAppLogic(log, shaper, v)
 		if err != nil {
 			return config.T{}, logic.Option{}, nil, nil, err
 		}
@@ -141,17 +217,25 @@ func readConfig(confFile string) (config.T, logic.Option, []logic.Option,
 		nil
 }
 
-func signalsCatcher(confFile string, log logger.T, ch chan<- confChan) {
+func signalsCatcher(confFile string, log logger.T, registry *sessions.T,
+	limits *limiter.T, ch chan<- confChan) {
 	sigint := make(chan os.Signal, 1)
-	signal.Notify(sigint,
+	signal.Notify(sigint, append([]os.Signal{
 		syscall.SIGHUP,
 		syscall.SIGINT,
-		syscall.SIGTERM)
+		syscall.SIGTERM}, reopenSignals...)...)
 	for {
 		switch <-sigint {
 		case syscall.SIGHUP:
 			log.LogWarning("Config reloading")
 			conf, def, opts, logNew, err := readConfig(confFile)
+			var appLogic *logic.AppLogic
+			if err == nil {
+				limits = limits.Update(conf.Limits)
+				if appLogic, err = newLogic(conf, def, opts, registry, limits); err != nil {
+					_ = logNew.Close()
+				}
+			}
 			if err != nil {
 				log.LogError("Config reload", "error", err)
 			} else {
@@ -160,7 +244,7 @@ func signalsCatcher(confFile string, log logger.T, ch chan<- confChan) {
 					log.LogError("log file close", "error", err)
 					ch <- confChan{config.T{}, nil, false}
 				} else {
-					ch <- confChan{conf, logic.New(def, opts), true}
+					ch <- confChan{conf, appLogic, true}
 					log = logNew
 				}
 			}
@@ -173,11 +257,57 @@ func signalsCatcher(confFile string, log logger.T, ch chan<- confChan) {
 				log.LogError("log file close", "error", err)
 			}
 			ch <- confChan{}
+		default:
+			// reopenSignals
+			log.LogInfo("Reopening log files")
+			if err := rotate.Reopen(); err != nil {
+				log.LogError("Log files reopen", "error", err)
+			}
 		}
 	}
 }
 
-func getNewAppLogic(log logger.T, v config.SubT) (logic.Option, error) {
+func newLogic(conf config.T, def logic.Option, opts []logic.Option,
+	registry *sessions.T, limits *limiter.T) (*logic.AppLogic, error) {
+	signer, err := sign.New(conf.Signing)
+	if err != nil {
+		return nil, err
+	}
+	return logic.New(def, opts, logic.Global{
+		Rewrite:    conf.Rewrite,
+		Devices:    conf.DeviceProfiles,
+		Tokens:     conf.Tokens,
+		Limits:     limits,
+		Signer:     signer,
+		AdminToken: conf.AdminToken,
+		Sessions:   registry,
+	})
+}
+
+// Sign returns signed route request uri for link,
+// zero expire selects config expire-time
+func Sign(confFile string, route string, link string, options string,
+	expire time.Duration) (string, error) {
+	conf, err := config.Read(confFile)
+	if err != nil {
+		return "", err
+	}
+	signer, err := sign.New(conf.Signing)
+	if err != nil {
+		return "", err
+	}
+	opts, err := url.ParseQuery(options)
+	if err != nil {
+		return "", err
+	}
+	if expire == 0 && signer != nil {
+		expire = signer.ExpireTime()
+	}
+	return logic.SignedURI(signer, conf.Rewrite, route, link, opts, time.Now().Add(expire))
+}
+
+func getNewAppLogic(log logger.T, shaper *limiter.ShaperT,
+	v config.SubT) (logic.Option, error) {
 	texts := [3]string{
 		"Extractor",
 		"Cache",
@@ -202,9 +332,28 @@ func getNewAppLogic(log logger.T, v config.SubT) (logic.Option, error) {
 	if err != nil {
 		return logic.Option{}, nameErr(texts[1], err)
 	}
+	_playlistCache,
+		err := cache_mux.NewMeta(*v.Cache.PlaylistExpireTime, "playlist cache",
+		logger_mux.NewLayer(log, newName(texts[1])))
+	if err != nil {
+		return logic.Option{}, nameErr(texts[1], err)
+	}
+	_infoCache,
+		err := cache_mux.NewMeta(*v.Cache.InfoExpireTime, "info cache",
+		logger_mux.NewLayer(log, newName(texts[1])))
+	if err != nil {
+		return logic.Option{}, nameErr(texts[1], err)
+	}
+	_thumbnailCache,
+		err := cache_mux.NewFile(*v.Cache.ThumbnailDir, *v.Cache.ThumbnailMaxSize,
+		*v.Cache.ThumbnailExpireTime, "thumbnail cache",
+		logger_mux.NewLayer(log, newName(texts[1])))
+	if err != nil {
+		return logic.Option{}, nameErr(texts[1], err)
+	}
 	_streamer,
 		err := streamer.New(v.Streamer,
-		logger_mux.NewLayer(log, newName(texts[2])), _extractor)
+		logger_mux.NewLayer(log, newName(texts[2])), _extractor, shaper)
 	if err != nil {
 		return logic.Option{}, nameErr(texts[2], err)
 	}
@@ -214,8 +363,13 @@ func getNewAppLogic(log logger.T, v config.SubT) (logic.Option, error) {
 			X:                  _extractor,
 			S:                  _streamer,
 			C:                  _cache,
+			PC:                 _playlistCache,
+			IC:                 _infoCache,
+			TC:                 _thumbnailCache,
 			DefaultVideoHeight: v.DefaultVideoHeight,
 			MaxVideoHeight:     v.MaxVideoHeight,
+			Selectable:         v.Selectable,
+			Access:             v.Access,
 		},
 		nil
 }
@@ -0,0 +1,8 @@
+//go:build !(aix || darwin || dragonfly || freebsd || illumos || linux || netbsd || openbsd || solaris)
+
+package app
+
+import "os"
+
+// reopenSignals make log files reopen, there is no SIGUSR1 here
+var reopenSignals []os.Signal
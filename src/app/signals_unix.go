@@ -0,0 +1,11 @@
+//go:build aix || darwin || dragonfly || freebsd || illumos || linux || netbsd || openbsd || solaris
+
+package app
+
+import (
+	"os"
+	"syscall"
+)
+
+// reopenSignals make log files reopen
+var reopenSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,108 @@
+// Package auth contains API tokens
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const bearerPrefix = "Bearer "
+
+// TokenT is API token, empty SubConfigs allows any sub-config
+type TokenT struct {
+	Token      string   `json:"token"`
+	Label      string   `json:"label"`
+	SubConfigs []string `json:"sub-configs"`
+}
+
+// ListT is tokens list, empty list disables authentication
+type ListT struct {
+	list []TokenT
+}
+
+// UnmarshalJSON is custom json unmarshal func, do not use directly
+func (t *ListT) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &t.list); err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for _, v := range t.list {
+		if v.Token == "" {
+			return fmt.Errorf("empty token")
+		}
+		if strings.ContainsAny(v.Token, "/?&=# ") {
+			return fmt.Errorf("token %q contains reserved characters", v.Label)
+		}
+		if seen[v.Token] {
+			return fmt.Errorf("duplicate token %q", v.Label)
+		}
+		seen[v.Token] = true
+	}
+	return nil
+}
+
+// Enabled checks if any token is configured
+func (t ListT) Enabled() bool {
+	return len(t.list) > 0
+}
+
+// Lookup finds token
+func (t ListT) Lookup(token string) (TokenT, bool) {
+	if token == "" {
+		return TokenT{}, false
+	}
+	for _, v := range t.list {
+		if subtle.ConstantTimeCompare([]byte(v.Token), []byte(token)) == 1 {
+			return v, true
+		}
+	}
+	return TokenT{}, false
+}
+
+// Allows checks if token may use sub-config
+func (t TokenT) Allows(subConfig string) bool {
+	if len(t.SubConfigs) == 0 {
+		return true
+	}
+	for _, v := range t.SubConfigs {
+		if v == subConfig {
+			return true
+		}
+	}
+	return false
+}
+
+// Bearer returns Authorization header token
+func Bearer(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if len(h) > len(bearerPrefix) && strings.EqualFold(h[:len(bearerPrefix)], bearerPrefix) {
+		return strings.TrimSpace(h[len(bearerPrefix):])
+	}
+	return ""
+}
+
+// SetBearer sets Authorization header token
+func SetBearer(r *http.Request, token string) {
+	r.Header.Set("Authorization", bearerPrefix+token)
+}
+
+// PathToken returns "/<route>/<token>/..." or "/<route>/<token>?..." token
+// and request uri without it, if token is in list
+func (t ListT) PathToken(uri string) (string, string, bool) {
+	route, rest, ok := strings.Cut(strings.TrimPrefix(uri, "/"), "/")
+	if !ok {
+		return "", uri, false
+	}
+	end := strings.IndexAny(rest, "/?")
+	if end < 0 {
+		end = len(rest)
+	}
+	token := rest[:end]
+	if _, ok := t.Lookup(token); !ok {
+		return "", uri, false
+	}
+	return token, "/" + route + rest[end:], true
+}
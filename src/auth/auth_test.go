@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestPathToken(t *testing.T) {
+	var list ListT
+	if err := json.Unmarshal([]byte(`[
+		{"token": "abc", "label": "tv"},
+		{"token": "def", "label": "radio", "sub-configs": ["radio"]}
+	]`), &list); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []struct {
+		uri, token, rest string
+	}{
+		{"/play/abc/youtu.be/x?/?vh=360", "abc", "/play/youtu.be/x?/?vh=360"},
+		{"/play/def?u=youtu.be%2Fx", "def", "/play?u=youtu.be%2Fx"},
+		{"/search/abc/?q=a", "abc", "/search/?q=a"},
+		{"/play/youtu.be/x", "", "/play/youtu.be/x"},
+		{"/play?u=x&token=abc", "", "/play?u=x&token=abc"},
+	} {
+		token, rest, ok := list.PathToken(v.uri)
+		if token != v.token || rest != v.rest || ok != (v.token != "") {
+			t.Error("For", v.uri, "expected", v.token, v.rest, "got", token, rest, ok)
+		}
+	}
+	radio, ok := list.Lookup("def")
+	if !ok || !radio.Allows("radio") || radio.Allows("default") {
+		t.Error("Unexpected radio token", radio, ok)
+	}
+	if tv, ok := list.Lookup("abc"); !ok || !tv.Allows("any") {
+		t.Error("Unexpected tv token", tv, ok)
+	}
+	if _, ok := list.Lookup("xyz"); ok {
+		t.Error("Unexpected token found")
+	}
+}
+
+func TestBearer(t *testing.T) {
+	for k, v := range map[string]string{
+		"Bearer abc": "abc",
+		"bearer abc": "abc",
+		"Basic abc":  "",
+		"Bearer":     "",
+	} {
+		r := &http.Request{Header: http.Header{"Authorization": {k}}}
+		if res := Bearer(r); res != v {
+			t.Error("For", k, "expected", v, "got", res)
+		}
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	for _, v := range []string{
+		`[{"token": ""}]`,
+		`[{"token": "a/b"}]`,
+		`[{"token": "a"}, {"token": "a"}]`,
+	} {
+		var list ListT
+		if err := json.Unmarshal([]byte(v), &list); err == nil {
+			t.Error("For", v, "expected error")
+		}
+	}
+}
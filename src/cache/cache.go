@@ -14,7 +14,25 @@ type T interface {
 	CleanExpired(time.Time) []extractor.RequestT
 }
 
+// MetaT is metadata cache interface
+type MetaT interface {
+	Add(string, extractor.InfoT, time.Time)
+	Get(string) (extractor.InfoT, bool)
+	CleanExpired(time.Time) []string
+}
+
+// FileT is binary data cache interface
+type FileT interface {
+	Add(string, []byte) error
+	Get(string) ([]byte, bool)
+}
+
 // ConfigT is constructor config
 type ConfigT struct {
-	ExpireTime *string `json:"expire-time"`
+	ExpireTime          *string `json:"expire-time"`
+	PlaylistExpireTime  *string `json:"playlist-expire-time"`
+	InfoExpireTime      *string `json:"info-expire-time"`
+	ThumbnailDir        *string `json:"thumbnail-dir"`
+	ThumbnailMaxSize    *uint64 `json:"thumbnail-max-size"`
+	ThumbnailExpireTime *string `json:"thumbnail-expire-time"`
 }
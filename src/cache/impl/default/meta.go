@@ -0,0 +1,54 @@
+package defaultcache
+
+import (
+	"sync"
+	"time"
+
+	cache "ytproxy/cache"
+	extractor "ytproxy/extractor"
+)
+
+// NewMeta creates default metadata cache instance
+func NewMeta(t time.Duration) cache.MetaT {
+	return &metaCache{
+		cache:      make(map[string]metaEntry),
+		expireTime: t,
+	}
+}
+
+type metaEntry struct {
+	info   extractor.InfoT
+	expire time.Time
+}
+
+type metaCache struct {
+	sync.Mutex
+	cache      map[string]metaEntry
+	expireTime time.Duration
+}
+
+func (t *metaCache) Add(key string, info extractor.InfoT, now time.Time) {
+	t.Lock()
+	t.cache[key] = metaEntry{info: info, expire: now.Add(t.expireTime)}
+	t.Unlock()
+}
+
+func (t *metaCache) Get(key string) (extractor.InfoT, bool) {
+	t.Lock()
+	defer t.Unlock()
+	v, ok := t.cache[key]
+	return v.info, ok
+}
+
+func (t *metaCache) CleanExpired(now time.Time) []string {
+	deleted := make([]string, 0)
+	t.Lock()
+	for k, v := range t.cache {
+		if v.expire.Before(now) {
+			delete(t.cache, k)
+			deleted = append(deleted, k)
+		}
+	}
+	t.Unlock()
+	return deleted
+}
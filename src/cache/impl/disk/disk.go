@@ -0,0 +1,149 @@
+// Package diskcache implements on-disk binary data cache
+package diskcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	cache "ytproxy/cache"
+)
+
+const tmpPrefix = "tmp-"
+
+// New creates disk cache instance storing files in dir.
+// Files older than expireTime are not served, oldest files are removed
+// when cache is bigger than maxSize bytes. Zero values disable limits.
+func New(dir string, maxSize int64, expireTime time.Duration) (cache.FileT, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	t := &diskCache{dir: dir, maxSize: maxSize, expireTime: expireTime}
+	files, err := t.files()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range files {
+		t.size += v.Size()
+	}
+	return t, nil
+}
+
+type diskCache struct {
+	dir        string
+	maxSize    int64
+	expireTime time.Duration
+	mu         sync.Mutex
+	size       int64
+}
+
+func (t *diskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(t.dir, hex.EncodeToString(sum[:]))
+}
+
+func (t *diskCache) Add(key string, data []byte) error {
+	// write to temporary file first, so readers never see partial files
+	f, err := os.CreateTemp(t.dir, tmpPrefix)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p := t.path(key)
+	if fi, err := os.Stat(p); err == nil {
+		t.size -= fi.Size()
+	}
+	if err := os.Rename(f.Name(), p); err != nil {
+		return err
+	}
+	t.size += int64(len(data))
+	return t.prune()
+}
+
+func (t *diskCache) Get(key string) ([]byte, bool) {
+	p := t.path(key)
+	if t.expireTime > 0 {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, false
+		}
+		if time.Since(fi.ModTime()) > t.expireTime {
+			t.remove(p)
+			return nil, false
+		}
+	}
+	b, err := os.ReadFile(p)
+	return b, err == nil
+}
+
+// remove deletes cached file
+func (t *diskCache) remove(p string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if fi, err := os.Stat(p); err == nil && os.Remove(p) == nil {
+		t.size -= fi.Size()
+	}
+}
+
+// prune removes oldest files until cache fits in maxSize
+func (t *diskCache) prune() error {
+	if t.maxSize <= 0 || t.size <= t.maxSize {
+		return nil
+	}
+	files, err := t.files()
+	if err != nil {
+		return err
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+	t.size = 0
+	for _, v := range files {
+		t.size += v.Size()
+	}
+	for _, v := range files {
+		if t.size <= t.maxSize {
+			break
+		}
+		if err := os.Remove(filepath.Join(t.dir, v.Name())); err != nil {
+			return err
+		}
+		t.size -= v.Size()
+	}
+	return nil
+}
+
+// files lists cached files
+func (t *diskCache) files() ([]os.FileInfo, error) {
+	list, err := os.ReadDir(t.dir)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]os.FileInfo, 0, len(list))
+	for _, v := range list {
+		if !v.Type().IsRegular() || strings.HasPrefix(v.Name(), tmpPrefix) {
+			continue
+		}
+		fi, err := v.Info()
+		if err != nil {
+			continue
+		}
+		res = append(res, fi)
+	}
+	return res, nil
+}
@@ -0,0 +1,44 @@
+package diskcache
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLimits(t *testing.T) {
+	dir := t.TempDir()
+	c, err := New(dir, 250, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Minute)
+	for k, v := range []string{"a", "b", "c"} {
+		if err := c.Add(v, make([]byte, 100)); err != nil {
+			t.Fatal(err)
+		}
+		// mtime resolution may be coarse, keep files ordered
+		mtime := old.Add(time.Duration(k) * time.Second)
+		if err := os.Chtimes(c.(*diskCache).path(v), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := c.Get("a"); ok {
+		t.Error("expected oldest file removed")
+	}
+	for _, v := range []string{"b", "c"} {
+		if b, ok := c.Get(v); !ok || len(b) != 100 {
+			t.Error("For", v, "expected cached file, got", len(b), ok)
+		}
+	}
+	expired := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(c.(*diskCache).path("b"), expired, expired); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get("b"); ok {
+		t.Error("expected expired file not served")
+	}
+	if r := c.(*diskCache).size; r != 100 {
+		t.Error("expected size 100, got", r)
+	}
+}
@@ -26,3 +26,36 @@ func (t *emptyCache) Get(_ extractor.RequestT) (extractor.ResultT, bool) {
 func (t *emptyCache) CleanExpired(_ time.Time) []extractor.RequestT {
 	return []extractor.RequestT{}
 }
+
+// NewMeta creates dummy metadata cache instance
+func NewMeta() cache.MetaT {
+	return &emptyMetaCache{}
+}
+
+type emptyMetaCache struct{}
+
+func (t *emptyMetaCache) Add(_ string, _ extractor.InfoT, _ time.Time) {
+}
+
+func (t *emptyMetaCache) Get(_ string) (extractor.InfoT, bool) {
+	return extractor.InfoT{}, false
+}
+
+func (t *emptyMetaCache) CleanExpired(_ time.Time) []string {
+	return []string{}
+}
+
+// NewFile creates dummy binary data cache instance
+func NewFile() cache.FileT {
+	return &emptyFileCache{}
+}
+
+type emptyFileCache struct{}
+
+func (t *emptyFileCache) Add(_ string, _ []byte) error {
+	return nil
+}
+
+func (t *emptyFileCache) Get(_ string) ([]byte, bool) {
+	return nil, false
+}
@@ -7,6 +7,7 @@ import (
 
 	cache "ytproxy/cache"
 	cache_default "ytproxy/cache/impl/default"
+	cache_disk "ytproxy/cache/impl/disk"
 	cache_empty "ytproxy/cache/impl/empty"
 	logger "ytproxy/logger"
 )
@@ -24,3 +25,38 @@ func New(conf cache.ConfigT, log logger.T) (cache.T, error) {
 	log.LogDebug("", fmt.Sprintf("expire time set to %s", t))
 	return cache_default.New(t), nil
 }
+
+// NewMeta creates metadata cache with expireTime, name is used in logs
+func NewMeta(expireTime string, name string, log logger.T) (cache.MetaT, error) {
+	t, err := time.ParseDuration(expireTime)
+	if err != nil {
+		return cache_default.NewMeta(0), fmt.Errorf("%s: %s", name, err)
+	}
+	if t.Seconds() < 1 {
+		log.LogDebug("", fmt.Sprintf("%s disabled by config", name))
+		return cache_empty.NewMeta(), nil
+	}
+	log.LogDebug("", fmt.Sprintf("%s expire time set to %s", name, t))
+	return cache_default.NewMeta(t), nil
+}
+
+// NewFile creates on-disk cache in dir, empty dir disables cache.
+// maxSize is in MiB, zero maxSize or expireTime disable limit.
+func NewFile(dir string, maxSize uint64, expireTime string, name string,
+	log logger.T) (cache.FileT, error) {
+	if dir == "" {
+		log.LogDebug("", fmt.Sprintf("%s disabled by config", name))
+		return cache_empty.NewFile(), nil
+	}
+	t, err := time.ParseDuration(expireTime)
+	if err != nil {
+		return cache_empty.NewFile(), fmt.Errorf("%s: %s", name, err)
+	}
+	log.LogDebug("", fmt.Sprintf("%s directory set to %s, max size %d MiB, expire time %s",
+		name, dir, maxSize, t))
+	c, err := cache_disk.New(dir, int64(maxSize)<<20, t)
+	if err != nil {
+		return cache_empty.NewFile(), fmt.Errorf("%s: %s", name, err)
+	}
+	return c, nil
+}
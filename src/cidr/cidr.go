@@ -0,0 +1,122 @@
+// Package cidr contains client address matching funcs
+package cidr
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ListT is list of networks
+type ListT []*net.IPNet
+
+// Parse parses CIDR list, single addresses are allowed
+func Parse(list []string) (ListT, error) {
+	res := make(ListT, 0, len(list))
+	for _, v := range list {
+		v = strings.TrimSpace(v)
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("bad address %q", v)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			res = append(res, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, n)
+	}
+	return res, nil
+}
+
+// UnmarshalJSON is custom json unmarshal func, do not use directly
+func (t *ListT) UnmarshalJSON(b []byte) error {
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	res, err := Parse(list)
+	if err != nil {
+		return err
+	}
+	*t = res
+	return nil
+}
+
+// Contains checks if ip is in any of networks
+func (t ListT) Contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, v := range t {
+		if v.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// IP parses "host:port" or bare address
+func IP(addr string) net.IP {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	return net.ParseIP(strings.Trim(addr, "[]"))
+}
+
+// AccessT is client address allow and deny lists.
+// Deny list is checked first, empty allow list allows any address
+type AccessT struct {
+	Allow ListT `json:"allow"`
+	Deny  ListT `json:"deny"`
+}
+
+// Allowed checks if ip is allowed
+func (t AccessT) Allowed(ip net.IP) bool {
+	if t.Deny.Contains(ip) {
+		return false
+	}
+	return len(t.Allow) == 0 || t.Allow.Contains(ip)
+}
+
+// RealIP returns client address of r without port. X-Forwarded-For
+// and X-Real-IP headers are honored only if r comes from trusted proxy.
+// X-Forwarded-For is walked from the right skipping trusted proxies,
+// walk stops at the last trusted hop on invalid entry
+func RealIP(r *http.Request, trusted ListT) string {
+	remote := IP(r.RemoteAddr)
+	if remote == nil {
+		return r.RemoteAddr
+	}
+	if !trusted.Contains(remote) {
+		return remote.String()
+	}
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		last := remote
+		list := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(list) - 1; i >= 0; i-- {
+			ip := IP(strings.TrimSpace(list[i]))
+			if ip == nil {
+				break
+			}
+			last = ip
+			if !trusted.Contains(ip) {
+				break
+			}
+		}
+		return last.String()
+	}
+	if ip := IP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+	return remote.String()
+}
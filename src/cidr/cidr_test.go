@@ -0,0 +1,84 @@
+package cidr
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestContains(t *testing.T) {
+	list, err := Parse([]string{"192.168.1.0/24", "10.0.0.1", "fd00::/8", "::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string]bool{
+		"192.168.1.10:5000": true,
+		"192.168.2.10:5000": false,
+		"10.0.0.1":          true,
+		"10.0.0.2":          false,
+		"[fd00::1]:80":      true,
+		"[::1]:80":          true,
+		"::2":               false,
+		"garbage":           false,
+	} {
+		if r := list.Contains(IP(k)); r != v {
+			t.Error("For", k, "expected", v, "got", r)
+		}
+	}
+	for _, v := range []string{"1.2.3.4/33", "host"} {
+		if _, err := Parse([]string{v}); err == nil {
+			t.Error("For", v, "expected error")
+		}
+	}
+}
+
+func TestAccess(t *testing.T) {
+	var a AccessT
+	if err := json.Unmarshal([]byte(`{"allow": ["192.168.0.0/16"], "deny": ["192.168.1.13"]}`),
+		&a); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string]bool{
+		"192.168.1.12": true,
+		"192.168.1.13": false,
+		"10.0.0.1":     false,
+	} {
+		if r := a.Allowed(IP(k)); r != v {
+			t.Error("For", k, "expected", v, "got", r)
+		}
+	}
+	if !(AccessT{}).Allowed(IP("10.0.0.1")) {
+		t.Error("Empty access should allow any address")
+	}
+}
+
+func TestRealIP(t *testing.T) {
+	trusted, err := Parse([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []struct {
+		remote, xff, xrip, want string
+	}{
+		{"1.2.3.4:100", "5.6.7.8", "", "1.2.3.4"},
+		{"[::1]:100", "", "", "::1"},
+		{"10.0.0.1:100", "5.6.7.8", "", "5.6.7.8"},
+		{"10.0.0.1:100", "9.9.9.9, 5.6.7.8, 10.0.0.2", "", "5.6.7.8"},
+		{"10.0.0.1:100", "10.0.0.3, 10.0.0.2", "", "10.0.0.3"},
+		{"10.0.0.1:100", "", "5.6.7.8", "5.6.7.8"},
+		{"10.0.0.1:100", "garbage", "5.6.7.8", "10.0.0.1"},
+		{"10.0.0.1:100", "5.6.7.8, garbage, 10.0.0.2", "9.9.9.9", "10.0.0.2"},
+		{"10.0.0.1:100", "", "", "10.0.0.1"},
+	} {
+		r := &http.Request{RemoteAddr: v.remote, Header: http.Header{}}
+		if v.xff != "" {
+			r.Header.Set("X-Forwarded-For", v.xff)
+		}
+		if v.xrip != "" {
+			r.Header.Set("X-Real-IP", v.xrip)
+		}
+		if res := RealIP(r, trusted); res != v.want {
+			t.Error("For", v, "expected", v.want, "got", res)
+		}
+	}
+}
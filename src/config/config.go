@@ -7,9 +7,17 @@ import (
 	"os"
 	"strings"
 
+	auth "ytproxy/auth"
 	cache "ytproxy/cache"
+	cidr "ytproxy/cidr"
+	device "ytproxy/device"
+	dlna "ytproxy/dlna"
 	extractor "ytproxy/extractor"
+	limiter "ytproxy/limiter"
 	logger "ytproxy/logger"
+	rewrite "ytproxy/rewrite"
+	routes "ytproxy/routes"
+	sign "ytproxy/sign"
 	streamer "ytproxy/streamer"
 )
 
@@ -24,12 +32,23 @@ type T struct {
 	Extractor          extractor.ConfigT `json:"extractor"`
 	Log                logger.ConfigT    `json:"log"`
 	Cache              cache.ConfigT     `json:"cache"`
+	DLNA               dlna.ConfigT      `json:"dlna"`
+	Routes             routes.T          `json:"routes"`
+	Rewrite            rewrite.T         `json:"rewrite"`
+	DeviceProfiles     device.ListT      `json:"device-profiles"`
+	Tokens             auth.ListT        `json:"tokens"`
+	Access             cidr.AccessT      `json:"access"`
+	TrustedProxies     cidr.ListT        `json:"trusted-proxies"`
+	Limits             limiter.ConfigT   `json:"limits"`
+	Signing            sign.ConfigT      `json:"signing"`
+	AdminToken         string            `json:"admin-token"`
 	SubConfig          []SubT            `json:"sub-config"`
 }
 
 // SubT is type for extra configs
 type SubT struct {
-	Name string `json:"name"`
+	Name       string `json:"name"`
+	Selectable bool   `json:"selectable"`
 	T
 }
 
@@ -38,21 +57,44 @@ func defaultConfig() T {
 	tru := true
 	ext := streamer.Extractor
 	tv := streamer.TLSVersion(0)
+	hb := uint64(3)
 	var s = [4]string{"corrupted.mp4",
 		"failed.m4a",
 		"Mozilla",
 		"env",
 	}
-	var e = [4]string{"yt-dlp",
+	var e = [7]string{"yt-dlp",
 		"-f,,(mp4)[height<={{.HEIGHT}}],,-g,,{{.URL}}",
 		"-f,,(m4a),,-g,,{{.URL}}",
 		"--dump-user-agent",
+		"--flat-playlist,,-J,,{{.URL}}",
+		"--flat-playlist,,-J,,ytsearch{{.COUNT}}:{{.QUERY}}",
+		"--no-playlist,,-J,,{{.URL}}",
 	}
 	co := make([]string, 0)
 	ll := logger.Info
 	lo := logger.Stdout
 	lf := "log.txt"
+	al := ""
+	af := logger.Combined
+	ri := "0s"
 	exp := "3h"
+	pexp := "1h"
+	tdir := ""
+	tsize := uint64(100)
+	texp := "168h"
+	dn := "yt-proxy"
+	du := ""
+	di := ""
+	dt := ""
+	dc := make([]dlna.ContainerT, 0)
+	var (
+		zr float64
+		zn uint64
+	)
+	sk := make([]string, 0)
+	se := "YTPROXY_SIGNING_KEYS"
+	sexp := "24h"
 	return T{
 		PortInt:            8080,
 		Host:               "0.0.0.0",
@@ -68,6 +110,12 @@ func defaultConfig() T {
 			UserAgent:            &s[2],
 			Proxy:                &s[3],
 			MinTLSVersion:        &tv,
+			HLSToTS:              &fls,
+			HLSBuffer:            &hb,
+			DLNAHeaders:          &fls,
+			ClientBandwidth:      &zn,
+			ClientBandwidthBurst: &zn,
+			AllowUpstream:        &cidr.ListT{},
 		},
 		Extractor: extractor.ConfigT{
 			Path:          &e[0],
@@ -76,15 +124,54 @@ func defaultConfig() T {
 			GetUserAgent:  &e[3],
 			CustomOptions: &co,
 			ForceHTTPS:    &tru,
+			Playlist:      &e[4],
+			Search:        &e[5],
+			Info:          &e[6],
 		},
 		Log: logger.ConfigT{
-			Level:    &ll,
-			JSON:     &fls,
-			Output:   &lo,
-			FileName: &lf,
+			Level:          &ll,
+			JSON:           &fls,
+			Output:         &lo,
+			FileName:       &lf,
+			AccessLog:      &al,
+			AccessFormat:   &af,
+			RotateSize:     &zn,
+			RotateInterval: &ri,
+			RotateKeep:     &zn,
+			RotateGzip:     &fls,
 		},
 		Cache: cache.ConfigT{
-			ExpireTime: &exp,
+			ExpireTime:          &exp,
+			PlaylistExpireTime:  &pexp,
+			InfoExpireTime:      &pexp,
+			ThumbnailDir:        &tdir,
+			ThumbnailMaxSize:    &tsize,
+			ThumbnailExpireTime: &texp,
+		},
+		DLNA: dlna.ConfigT{
+			Enabled:      &fls,
+			FriendlyName: &dn,
+			UUID:         &du,
+			Interface:    &di,
+			Token:        &dt,
+			Containers:   &dc,
+		},
+		Limits: limiter.ConfigT{
+			PlayRate:       &zr,
+			PlayBurst:      &zn,
+			ExtractRate:    &zr,
+			ExtractBurst:   &zn,
+			ClientStreams:  &zn,
+			Streams:        &zn,
+			ErrorMedia:     &fls,
+			Bandwidth:      &zn,
+			BandwidthBurst: &zn,
+		},
+		Signing: sign.ConfigT{
+			Keys:       &sk,
+			KeysEnv:    &se,
+			Required:   &fls,
+			ExpireTime: &sexp,
 		},
 	}
 }
@@ -132,6 +219,24 @@ func appendConfig(src T, dst T) T {
 	if dst.Streamer.MinTLSVersion == nil {
 		dst.Streamer.MinTLSVersion = src.Streamer.MinTLSVersion
 	}
+	if dst.Streamer.HLSToTS == nil {
+		dst.Streamer.HLSToTS = src.Streamer.HLSToTS
+	}
+	if dst.Streamer.HLSBuffer == nil {
+		dst.Streamer.HLSBuffer = src.Streamer.HLSBuffer
+	}
+	if dst.Streamer.DLNAHeaders == nil {
+		dst.Streamer.DLNAHeaders = src.Streamer.DLNAHeaders
+	}
+	if dst.Streamer.ClientBandwidth == nil {
+		dst.Streamer.ClientBandwidth = src.Streamer.ClientBandwidth
+	}
+	if dst.Streamer.ClientBandwidthBurst == nil {
+		dst.Streamer.ClientBandwidthBurst = src.Streamer.ClientBandwidthBurst
+	}
+	if dst.Streamer.AllowUpstream == nil {
+		dst.Streamer.AllowUpstream = src.Streamer.AllowUpstream
+	}
 	// extractor
 	if dst.Extractor.Path == nil {
 		dst.Extractor.Path = src.Extractor.Path
@@ -151,6 +256,15 @@ func appendConfig(src T, dst T) T {
 	if dst.Extractor.ForceHTTPS == nil {
 		dst.Extractor.ForceHTTPS = src.Extractor.ForceHTTPS
 	}
+	if dst.Extractor.Playlist == nil {
+		dst.Extractor.Playlist = src.Extractor.Playlist
+	}
+	if dst.Extractor.Search == nil {
+		dst.Extractor.Search = src.Extractor.Search
+	}
+	if dst.Extractor.Info == nil {
+		dst.Extractor.Info = src.Extractor.Info
+	}
 	// logger
 	if dst.Log.Level == nil {
 		dst.Log.Level = src.Log.Level
@@ -164,10 +278,103 @@ func appendConfig(src T, dst T) T {
 	if dst.Log.FileName == nil {
 		dst.Log.FileName = src.Log.FileName
 	}
+	if dst.Log.AccessLog == nil {
+		dst.Log.AccessLog = src.Log.AccessLog
+	}
+	if dst.Log.AccessFormat == nil {
+		dst.Log.AccessFormat = src.Log.AccessFormat
+	}
+	if dst.Log.RotateSize == nil {
+		dst.Log.RotateSize = src.Log.RotateSize
+	}
+	if dst.Log.RotateInterval == nil {
+		dst.Log.RotateInterval = src.Log.RotateInterval
+	}
+	if dst.Log.RotateKeep == nil {
+		dst.Log.RotateKeep = src.Log.RotateKeep
+	}
+	if dst.Log.RotateGzip == nil {
+		dst.Log.RotateGzip = src.Log.RotateGzip
+	}
 	// cache
 	if dst.Cache.ExpireTime == nil {
 		dst.Cache.ExpireTime = src.Cache.ExpireTime
 	}
+	if dst.Cache.PlaylistExpireTime == nil {
+		dst.Cache.PlaylistExpireTime = src.Cache.PlaylistExpireTime
+	}
+	if dst.Cache.InfoExpireTime == nil {
+		dst.Cache.InfoExpireTime = src.Cache.InfoExpireTime
+	}
+	if dst.Cache.ThumbnailDir == nil {
+		dst.Cache.ThumbnailDir = src.Cache.ThumbnailDir
+	}
+	if dst.Cache.ThumbnailMaxSize == nil {
+		dst.Cache.ThumbnailMaxSize = src.Cache.ThumbnailMaxSize
+	}
+	if dst.Cache.ThumbnailExpireTime == nil {
+		dst.Cache.ThumbnailExpireTime = src.Cache.ThumbnailExpireTime
+	}
+	// dlna
+	if dst.DLNA.Enabled == nil {
+		dst.DLNA.Enabled = src.DLNA.Enabled
+	}
+	if dst.DLNA.FriendlyName == nil {
+		dst.DLNA.FriendlyName = src.DLNA.FriendlyName
+	}
+	if dst.DLNA.UUID == nil {
+		dst.DLNA.UUID = src.DLNA.UUID
+	}
+	if dst.DLNA.Interface == nil {
+		dst.DLNA.Interface = src.DLNA.Interface
+	}
+	if dst.DLNA.Token == nil {
+		dst.DLNA.Token = src.DLNA.Token
+	}
+	if dst.DLNA.Containers == nil {
+		dst.DLNA.Containers = src.DLNA.Containers
+	}
+	// limits
+	if dst.Limits.PlayRate == nil {
+		dst.Limits.PlayRate = src.Limits.PlayRate
+	}
+	if dst.Limits.PlayBurst == nil {
+		dst.Limits.PlayBurst = src.Limits.PlayBurst
+	}
+	if dst.Limits.ExtractRate == nil {
+		dst.Limits.ExtractRate = src.Limits.ExtractRate
+	}
+	if dst.Limits.ExtractBurst == nil {
+		dst.Limits.ExtractBurst = src.Limits.ExtractBurst
+	}
+	if dst.Limits.ClientStreams == nil {
+		dst.Limits.ClientStreams = src.Limits.ClientStreams
+	}
+	if dst.Limits.Streams == nil {
+		dst.Limits.Streams = src.Limits.Streams
+	}
+	if dst.Limits.ErrorMedia == nil {
+		dst.Limits.ErrorMedia = src.Limits.ErrorMedia
+	}
+	if dst.Limits.Bandwidth == nil {
+		dst.Limits.Bandwidth = src.Limits.Bandwidth
+	}
+	if dst.Limits.BandwidthBurst == nil {
+		dst.Limits.BandwidthBurst = src.Limits.BandwidthBurst
+	}
+	// signing
+	if dst.Signing.Keys == nil {
+		dst.Signing.Keys = src.Signing.Keys
+	}
+	if dst.Signing.KeysEnv == nil {
+		dst.Signing.KeysEnv = src.Signing.KeysEnv
+	}
+	if dst.Signing.Required == nil {
+		dst.Signing.Required = src.Signing.Required
+	}
+	if dst.Signing.ExpireTime == nil {
+		dst.Signing.ExpireTime = src.Signing.ExpireTime
+	}
 	return dst
 }
 
@@ -219,7 +426,7 @@ func Read(path string) (T, error) {
 		if v.Name == "" {
 			return c, fmt.Errorf("sub-config name empty")
 		}
-		if len(v.Sites) == 0 {
+		if len(v.Sites) == 0 && !v.Selectable {
 			return c, fmt.Errorf("sub-config sites empty")
 		}
 		c.SubConfig[k].T = appendConfig(c, v.T)
@@ -0,0 +1,95 @@
+// Package device selects client device profile by User-Agent and address
+package device
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	cidr "ytproxy/cidr"
+)
+
+// ProfileT is device overrides, zero values are not overridden
+type ProfileT struct {
+	Name               string `json:"name"`
+	DefaultVideoHeight uint64 `json:"default-video-height"`
+	MaxVideoHeight     uint64 `json:"max-video-height"`
+	DefaultFormat      string `json:"default-format"`
+	SubConfig          string `json:"sub-config"`
+}
+
+// ListT is ordered device profiles list, first matching profile is used.
+// Config value is list of profiles with "user-agent" regex
+// and/or "cidr" list, all set conditions must match
+type ListT struct {
+	list []profileT
+}
+
+type profileT struct {
+	ProfileT
+	userAgent *regexp.Regexp
+	cidr      cidr.ListT
+}
+
+type configT struct {
+	ProfileT
+	UserAgent string   `json:"user-agent"`
+	CIDR      []string `json:"cidr"`
+}
+
+// UnmarshalJSON is custom json unmarshal func, do not use directly
+func (t *ListT) UnmarshalJSON(b []byte) error {
+	var list []configT
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	t.list = make([]profileT, 0, len(list))
+	for _, v := range list {
+		p := profileT{ProfileT: v.ProfileT}
+		if v.Name == "" {
+			return fmt.Errorf("device profile name empty")
+		}
+		if v.UserAgent == "" && len(v.CIDR) == 0 {
+			return fmt.Errorf("device profile %s: user-agent or cidr required", v.Name)
+		}
+		if v.DefaultFormat != "" && v.DefaultFormat != "mp4" && v.DefaultFormat != "m4a" {
+			return fmt.Errorf("device profile %s: default-format must be mp4 or m4a", v.Name)
+		}
+		var err error
+		if v.UserAgent != "" {
+			if p.userAgent, err = regexp.Compile(v.UserAgent); err != nil {
+				return fmt.Errorf("device profile %s: %s", v.Name, err)
+			}
+		}
+		if p.cidr, err = cidr.Parse(v.CIDR); err != nil {
+			return fmt.Errorf("device profile %s: %s", v.Name, err)
+		}
+		t.list = append(t.list, p)
+	}
+	return nil
+}
+
+// Profiles returns configured profiles in match order
+func (t ListT) Profiles() []ProfileT {
+	res := make([]ProfileT, 0, len(t.list))
+	for _, v := range t.list {
+		res = append(res, v.ProfileT)
+	}
+	return res
+}
+
+// Match returns first profile matching request
+func (t ListT) Match(r *http.Request) (ProfileT, bool) {
+	ip := cidr.IP(r.RemoteAddr)
+	for _, v := range t.list {
+		if v.userAgent != nil && !v.userAgent.MatchString(r.UserAgent()) {
+			continue
+		}
+		if len(v.cidr) > 0 && !v.cidr.Contains(ip) {
+			continue
+		}
+		return v.ProfileT, true
+	}
+	return ProfileT{}, false
+}
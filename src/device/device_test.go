@@ -0,0 +1,50 @@
+package device
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	var list ListT
+	if err := json.Unmarshal([]byte(`[
+		{"name": "tv", "user-agent": "SMART-TV", "cidr": ["192.168.1.20"],
+			"default-video-height": 1080, "max-video-height": 1080},
+		{"name": "box", "user-agent": "(?i)^old box", "default-video-height": 360,
+			"default-format": "mp4"},
+		{"name": "lan", "cidr": ["192.168.1.0/24"], "sub-config": "lan"}
+	]`), &list); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []struct {
+		ua, addr, want string
+	}{
+		{"Mozilla SMART-TV", "192.168.1.20:1000", "tv"},
+		{"Mozilla SMART-TV", "192.168.1.21:1000", "lan"},
+		{"OLD BOX 1.0", "10.0.0.1:1000", "box"},
+		{"player", "192.168.1.5:1000", "lan"},
+		{"player", "10.0.0.1:1000", ""},
+	} {
+		r := &http.Request{RemoteAddr: v.addr, Header: http.Header{"User-Agent": {v.ua}}}
+		p, ok := list.Match(r)
+		if ok != (v.want != "") || p.Name != v.want {
+			t.Error("For", v.ua, v.addr, "expected", v.want, "got", p.Name, ok)
+		}
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	for _, v := range []string{
+		`[{"user-agent": "a"}]`,
+		`[{"name": "a"}]`,
+		`[{"name": "a", "user-agent": "("}]`,
+		`[{"name": "a", "cidr": ["1.1.1.1/40"]}]`,
+		`[{"name": "a", "cidr": ["1.1.1.1"], "default-format": "avi"}]`,
+	} {
+		var list ListT
+		if err := json.Unmarshal([]byte(v), &list); err == nil {
+			t.Error("For", v, "expected error")
+		}
+	}
+}
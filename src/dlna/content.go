@@ -0,0 +1,334 @@
+package dlna
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	rootID          = "0"
+	containerPrefix = "c"
+	maxSOAPSize     = 64 << 10
+
+	errInvalidAction = 401
+	errInvalidArgs   = 402
+	errNoSuchObject  = 701
+)
+
+type soapError struct {
+	code int
+	desc string
+}
+
+func (e soapError) Error() string {
+	return fmt.Sprintf("%d %s", e.code, e.desc)
+}
+
+// objectT is DIDL-Lite container or item
+type objectT struct {
+	id         string
+	parent     string
+	title      string
+	container  bool
+	childCount int
+	link       string
+	mime       string
+	thumbnail  string
+	duration   float64
+}
+
+// parseSOAP returns action name and its arguments
+func parseSOAP(r *http.Request) (string, map[string]string, error) {
+	action := strings.Trim(r.Header.Get("SOAPACTION"), `"`)
+	if i := strings.LastIndexByte(action, '#'); i >= 0 {
+		action = action[i+1:]
+	}
+	args := make(map[string]string)
+	d := xml.NewDecoder(io.LimitReader(r.Body, maxSOAPSize))
+	var (
+		depth int
+		name  string
+		text  bytes.Buffer
+	)
+	// Envelope > Body > Action > Argument
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return action, args, err
+		}
+		switch v := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 3 && action == "" {
+				action = v.Name.Local
+			}
+			name = v.Name.Local
+			text.Reset()
+		case xml.CharData:
+			text.Write(v)
+		case xml.EndElement:
+			if depth == 4 {
+				args[name] = text.String()
+			}
+			depth--
+		}
+	}
+	return action, args, nil
+}
+
+func (t *T) contentDirectory(w http.ResponseWriter, r *http.Request) {
+	action, args, err := parseSOAP(r)
+	if err != nil {
+		t.log.LogWarning("SOAP parse", "error", err)
+		soapFault(w, soapError{errInvalidArgs, "Invalid Args"})
+		return
+	}
+	t.log.LogDebug("ContentDirectory", "action", action, "args", args)
+	var res [][2]string
+	switch action {
+	case "Browse":
+		res, err = t.browse(r, args)
+	case "GetSystemUpdateID":
+		res = [][2]string{{"Id", "1"}}
+	case "GetSearchCapabilities":
+		res = [][2]string{{"SearchCaps", ""}}
+	case "GetSortCapabilities":
+		res = [][2]string{{"SortCaps", ""}}
+	default:
+		err = soapError{errInvalidAction, "Invalid Action"}
+	}
+	if err != nil {
+		t.log.LogWarning("ContentDirectory", "action", action, "error", err)
+		soapFault(w, err)
+		return
+	}
+	soapResponse(w, contentDirectoryType, action, res)
+}
+
+func (t *T) connectionManager(w http.ResponseWriter, r *http.Request) {
+	action, _, err := parseSOAP(r)
+	if err != nil {
+		soapFault(w, soapError{errInvalidArgs, "Invalid Args"})
+		return
+	}
+	var res [][2]string
+	switch action {
+	case "GetProtocolInfo":
+		res = [][2]string{
+			{"Source", "http-get:*:video/mp4:*,http-get:*:audio/mp4:*"},
+			{"Sink", ""},
+		}
+	case "GetCurrentConnectionIDs":
+		res = [][2]string{{"ConnectionIDs", "0"}}
+	case "GetCurrentConnectionInfo":
+		res = [][2]string{
+			{"RcsID", "-1"}, {"AVTransportID", "-1"}, {"ProtocolInfo", ""},
+			{"PeerConnectionManager", ""}, {"PeerConnectionID", "-1"},
+			{"Direction", "Output"}, {"Status", "OK"},
+		}
+	default:
+		soapFault(w, soapError{errInvalidAction, "Invalid Action"})
+		return
+	}
+	soapResponse(w, connectionManagerType, action, res)
+}
+
+func (t *T) browse(r *http.Request, args map[string]string) ([][2]string, error) {
+	id := args["ObjectID"]
+	start, _ := strconv.Atoi(args["StartingIndex"])
+	count, _ := strconv.Atoi(args["RequestedCount"])
+	var list []objectT
+	switch args["BrowseFlag"] {
+	case "BrowseMetadata":
+		obj, err := t.object(r, id)
+		if err != nil {
+			return nil, err
+		}
+		list = []objectT{obj}
+	case "BrowseDirectChildren":
+		var err error
+		if list, err = t.children(r, id); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, soapError{errInvalidArgs, "Invalid Args"}
+	}
+	total := len(list)
+	if start < 0 || start > total {
+		start = total
+	}
+	list = list[start:]
+	if count > 0 && count < len(list) {
+		list = list[:count]
+	}
+	return [][2]string{
+		{"Result", didl(list)},
+		{"NumberReturned", strconv.Itoa(len(list))},
+		{"TotalMatches", strconv.Itoa(total)},
+		{"UpdateID", "1"},
+	}, nil
+}
+
+func (t *T) object(r *http.Request, id string) (objectT, error) {
+	if id == rootID {
+		return objectT{id: rootID, parent: "-1", title: t.name, container: true,
+			childCount: len(t.containers)}, nil
+	}
+	cid, item, isItem := strings.Cut(id, "/")
+	c, err := t.container(cid)
+	if err != nil {
+		return objectT{}, err
+	}
+	if !isItem {
+		return objectT{id: cid, parent: rootID, title: c.Title, container: true}, nil
+	}
+	list, err := t.children(r, cid)
+	if err != nil {
+		return objectT{}, err
+	}
+	for _, v := range list {
+		if v.id == cid+"/"+item {
+			return v, nil
+		}
+	}
+	return objectT{}, soapError{errNoSuchObject, "No such object"}
+}
+
+func (t *T) container(id string) (ContainerT, error) {
+	n, err := strconv.Atoi(strings.TrimPrefix(id, containerPrefix))
+	if !strings.HasPrefix(id, containerPrefix) || err != nil ||
+		n < 0 || n >= len(t.containers) {
+		return ContainerT{}, soapError{errNoSuchObject, "No such object"}
+	}
+	return t.containers[n], nil
+}
+
+func (t *T) children(r *http.Request, id string) ([]objectT, error) {
+	res := make([]objectT, 0)
+	if id == rootID {
+		for k, v := range t.containers {
+			res = append(res, objectT{
+				id:        fmt.Sprintf("%s%d", containerPrefix, k),
+				parent:    rootID,
+				title:     v.Title,
+				container: true,
+			})
+		}
+		return res, nil
+	}
+	c, err := t.container(id)
+	if err != nil {
+		return nil, err
+	}
+	mime := "video/mp4"
+	if opts, err := url.ParseQuery(c.Options); err == nil && opts.Get("vf") == "m4a" {
+		mime = "audio/mp4"
+	}
+	add := func(title, u, thumbnail string, duration float64) {
+		res = append(res, objectT{
+			id:        fmt.Sprintf("%s/%d", id, len(res)),
+			parent:    id,
+			title:     title,
+			link:      t.source.PlayLink(r, u, c.Options),
+			mime:      mime,
+			thumbnail: thumbnail,
+			duration:  duration,
+		})
+	}
+	for _, v := range c.Items {
+		add(v.Title, v.URL, "", 0)
+	}
+	if c.URL != "" {
+		entries, err := t.source.Entries(r, c.URL, c.Options, t.log)
+		if err != nil {
+			return nil, soapError{errNoSuchObject, err.Error()}
+		}
+		for _, v := range entries {
+			if v.URL != "" {
+				add(v.Title, v.URL, v.Thumbnail, v.Duration)
+			}
+		}
+	}
+	return res, nil
+}
+
+func didl(list []objectT) string {
+	var b strings.Builder
+	b.WriteString(`<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/"` +
+		` xmlns:dc="http://purl.org/dc/elements/1.1/"` +
+		` xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/">`)
+	for _, v := range list {
+		if v.container {
+			fmt.Fprintf(&b, `<container id="%s" parentID="%s" restricted="1"`,
+				xmlEscape(v.id), xmlEscape(v.parent))
+			if v.childCount > 0 {
+				fmt.Fprintf(&b, ` childCount="%d"`, v.childCount)
+			}
+			fmt.Fprintf(&b, `><dc:title>%s</dc:title>`+
+				`<upnp:class>object.container.storageFolder</upnp:class></container>`,
+				xmlEscape(v.title))
+			continue
+		}
+		class := "object.item.videoItem"
+		if strings.HasPrefix(v.mime, "audio/") {
+			class = "object.item.audioItem.musicTrack"
+		}
+		fmt.Fprintf(&b, `<item id="%s" parentID="%s" restricted="1">`+
+			`<dc:title>%s</dc:title><upnp:class>%s</upnp:class>`,
+			xmlEscape(v.id), xmlEscape(v.parent), xmlEscape(v.title), class)
+		if v.thumbnail != "" {
+			fmt.Fprintf(&b, `<upnp:albumArtURI>%s</upnp:albumArtURI>`, xmlEscape(v.thumbnail))
+		}
+		fmt.Fprintf(&b, `<res protocolInfo="http-get:*:%s:*"`, v.mime)
+		if v.duration > 0 {
+			fmt.Fprintf(&b, ` duration="%s"`, didlDuration(v.duration))
+		}
+		fmt.Fprintf(&b, `>%s</res></item>`, xmlEscape(v.link))
+	}
+	b.WriteString(`</DIDL-Lite>`)
+	return b.String()
+}
+
+// didlDuration formats seconds as H:MM:SS.mmm
+func didlDuration(d float64) string {
+	ms := int64(d * 1000)
+	return fmt.Sprintf("%d:%02d:%02d.%03d",
+		ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func soapResponse(w http.ResponseWriter, service, action string, args [][2]string) {
+	var b strings.Builder
+	for _, v := range args {
+		fmt.Fprintf(&b, "<%s>%s</%s>", v[0], xmlEscape(v[1]), v[0])
+	}
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	w.Header().Set("EXT", "")
+	_, _ = fmt.Fprintf(w, soapEnvelope,
+		fmt.Sprintf(`<u:%sResponse xmlns:u="%s">%s</u:%sResponse>`,
+			action, service, b.String(), action))
+}
+
+func soapFault(w http.ResponseWriter, err error) {
+	e, ok := err.(soapError)
+	if !ok {
+		e = soapError{errInvalidArgs, err.Error()}
+	}
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	w.WriteHeader(http.StatusInternalServerError)
+	_, _ = fmt.Fprintf(w, soapEnvelope, fmt.Sprintf(soapFaultBody, e.code, xmlEscape(e.desc)))
+}
@@ -0,0 +1,204 @@
+// Package dlna implements UPnP/DLNA MediaServer:
+// SSDP discovery, device description and ContentDirectory service
+package dlna
+
+import (
+	"crypto/md5"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	extractor "ytproxy/extractor"
+	logger "ytproxy/logger"
+)
+
+// Prefix is http routes prefix
+const Prefix = "/dlna/"
+
+// paths are relative to Prefix or to "/dlna/<token>/"
+const (
+	descriptionPath       = "description.xml"
+	contentDirectoryPath  = "ContentDirectory.xml"
+	connectionManagerPath = "ConnectionManager.xml"
+	controlPath           = "control/"
+	eventPath             = "event/"
+
+	deviceType               = "urn:schemas-upnp-org:device:MediaServer:1"
+	contentDirectoryType     = "urn:schemas-upnp-org:service:ContentDirectory:1"
+	connectionManagerType    = "urn:schemas-upnp-org:service:ConnectionManager:1"
+	contentDirectoryService  = "ContentDirectory"
+	connectionManagerService = "ConnectionManager"
+)
+
+// ConfigT is MediaServer config
+type ConfigT struct {
+	Enabled      *bool         `json:"enabled"`
+	FriendlyName *string       `json:"friendly-name"`
+	UUID         *string       `json:"uuid"`
+	Interface    *string       `json:"interface"`
+	Token        *string       `json:"token"`
+	Containers   *[]ContainerT `json:"containers"`
+}
+
+// ContainerT is browsable folder,
+// filled from playlist or channel url or from items list
+type ContainerT struct {
+	Title   string  `json:"title"`
+	URL     string  `json:"url"`
+	Options string  `json:"options"`
+	Items   []ItemT `json:"items"`
+}
+
+// ItemT is single favorite video
+type ItemT struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// SourceT lists containers content for client of r,
+// options are container options and may have client token
+type SourceT interface {
+	// Entries returns playlist or channel entries,
+	// client is authorized and limited as /playlist/ one
+	Entries(r *http.Request, link string, options string, log logger.T) ([]extractor.InfoT, error)
+	// PlayLink makes item /play/ link
+	PlayLink(r *http.Request, link string, options string) string
+	// Authorize checks client token as link routes do,
+	// Entries and PlayLink of r use it unless options have own token
+	Authorize(r *http.Request, token string) bool
+}
+
+// T is MediaServer instance
+type T struct {
+	name       string
+	uuid       string
+	token      string
+	base       string
+	containers []ContainerT
+	source     SourceT
+	log        logger.T
+	ssdp       *ssdp
+}
+
+// New creates and starts MediaServer, port is web server port.
+// Returns nil if disabled by config.
+func New(conf ConfigT, port uint16, source SourceT, log logger.T) (*T, error) {
+	if !*conf.Enabled {
+		return nil, nil
+	}
+	t := &T{
+		name:       *conf.FriendlyName,
+		uuid:       *conf.UUID,
+		token:      *conf.Token,
+		base:       Prefix,
+		containers: *conf.Containers,
+		source:     source,
+		log:        log,
+	}
+	if t.uuid == "" {
+		t.uuid = makeUUID(t.name, port)
+	}
+	if t.token != "" {
+		t.base = Prefix + url.PathEscape(t.token) + "/"
+	}
+	iface, ip, err := findInterface(*conf.Interface)
+	if err != nil {
+		return nil, err
+	}
+	log.LogInfo("Starting", "interface", iface.Name, "ip", ip, "uuid", t.uuid)
+	location := fmt.Sprintf("http://%s%s", net.JoinHostPort(ip.String(),
+		fmt.Sprintf("%d", port)), t.base+descriptionPath)
+	t.ssdp, err = newSSDP(iface, ip, ssdpPort, t.uuid, location, log)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Close stops SSDP announces
+func (t *T) Close() {
+	if t == nil {
+		return
+	}
+	t.ssdp.close()
+	t.log.LogInfo("Stopped")
+}
+
+// ServeHTTP serves description, SCPD and control requests.
+// Clients can not send tokens, so "/dlna/<token>/" path has configured token
+func (t *T) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p, token := r.URL.Path, ""
+	if t.token != "" && strings.HasPrefix(p, t.base) {
+		p, token = Prefix+strings.TrimPrefix(p, t.base), t.token
+	}
+	t.log.LogDebug("Request", "method", r.Method, "url", p, "addr", r.RemoteAddr)
+	if !t.source.Authorize(r, token) {
+		t.log.LogWarning("", "addr", r.RemoteAddr, "error", "missing or invalid token")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch p = strings.TrimPrefix(p, Prefix); {
+	case p == descriptionPath:
+		writeXML(w, fmt.Sprintf(deviceDescription, xmlEscape(t.name), t.uuid,
+			xmlEscape(t.base)))
+	case p == contentDirectoryPath:
+		writeXML(w, contentDirectorySCPD)
+	case p == connectionManagerPath:
+		writeXML(w, connectionManagerSCPD)
+	case p == controlPath+contentDirectoryService && r.Method == http.MethodPost:
+		t.contentDirectory(w, r)
+	case p == controlPath+connectionManagerService && r.Method == http.MethodPost:
+		t.connectionManager(w, r)
+	case strings.HasPrefix(p, eventPath):
+		// eventing is not supported, but some clients need subscription to succeed
+		w.Header().Set("SID", "uuid:"+t.uuid)
+		w.Header().Set("TIMEOUT", "Second-1800")
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeXML(w http.ResponseWriter, s string) {
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	_, _ = w.Write([]byte(s))
+}
+
+// makeUUID makes stable uuid from host name, server name and port
+func makeUUID(name string, port uint16) string {
+	host, _ := os.Hostname()
+	s := md5.Sum([]byte(fmt.Sprintf("%s|%s|%d", host, name, port)))
+	return fmt.Sprintf("%x-%x-%x-%x-%x", s[0:4], s[4:6], s[6:8], s[8:10], s[10:16])
+}
+
+// findInterface finds interface by name or first up multicast non-loopback one
+func findInterface(name string) (*net.Interface, net.IP, error) {
+	list, err := net.Interfaces()
+	if err != nil {
+		return nil, nil, err
+	}
+	for k, v := range list {
+		switch {
+		case name != "" && v.Name != name:
+			continue
+		case name == "" && (v.Flags&net.FlagUp == 0 ||
+			v.Flags&net.FlagLoopback != 0 || v.Flags&net.FlagMulticast == 0):
+			continue
+		}
+		addrs, err := v.Addrs()
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok && n.IP.To4() != nil {
+				return &list[k], n.IP.To4(), nil
+			}
+		}
+	}
+	if name != "" {
+		return nil, nil, fmt.Errorf("interface %q with IPv4 address not found", name)
+	}
+	return nil, nil, fmt.Errorf("no suitable network interface found")
+}
@@ -0,0 +1,191 @@
+package dlna
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	extractor "ytproxy/extractor"
+	logger "ytproxy/logger"
+	empty "ytproxy/logger/impl/empty"
+)
+
+func testLog(t *testing.T) logger.T {
+	log, err := empty.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return log
+}
+
+func TestSSDPHandle(t *testing.T) {
+	s := &ssdp{uuid: "id", location: "http://h/dlna/description.xml", log: testLog(t)}
+	search := func(man, st string) string {
+		return "M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nMAN: " + man +
+			"\r\nMX: 1\r\nST: " + st + "\r\n\r\n"
+	}
+	for _, v := range []struct {
+		packet string
+		count  int
+	}{
+		{search(discover, searchAll), 5},
+		{search(discover, deviceType), 1},
+		{search(discover, "uuid:id"), 1},
+		{search(discover, "urn:schemas-upnp-org:device:MediaRenderer:1"), 0},
+		{search(`"ssdp:other"`, searchAll), 0},
+		{"NOTIFY * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\n\r\n", 0},
+		{"garbage", 0},
+	} {
+		if res := s.handle([]byte(v.packet)); len(res) != v.count {
+			t.Errorf("For %q expected %d replies, got %d", v.packet, v.count, len(res))
+		}
+	}
+	res := string(s.handle([]byte(search(discover, rootDevice)))[0])
+	for _, v := range []string{"HTTP/1.1 200 OK\r\n", "LOCATION: " + s.location + "\r\n",
+		"USN: uuid:id::" + rootDevice + "\r\n"} {
+		if !strings.Contains(res, v) {
+			t.Errorf("Reply %q does not contain %q", res, v)
+		}
+	}
+}
+
+func TestSSDPLoopback(t *testing.T) {
+	iface := &net.Interface{Name: "lo", Flags: net.FlagUp | net.FlagLoopback}
+	ip := net.IPv4(127, 0, 0, 1)
+	s, err := newSSDP(iface, ip, 0, "id", "http://127.0.0.1/", testLog(t))
+	if err != nil {
+		t.Skip("cannot listen on loopback:", err)
+	}
+	defer s.close()
+	c, err := net.ListenUDP("udp4", &net.UDPAddr{IP: ip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	_, err = c.WriteToUDP([]byte("M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\n"+
+		"MAN: \"ssdp:discover\"\r\nMX: 1\r\nST: "+rootDevice+"\r\n\r\n"),
+		s.conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 4096)
+	n, _, err := c.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(buf[:n]), "ST: "+rootDevice) {
+		t.Errorf("Unexpected reply %q", buf[:n])
+	}
+}
+
+func browse(t *testing.T, h http.Handler, id, flag string) string {
+	body := `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/">` +
+		`<s:Body><u:Browse xmlns:u="` + contentDirectoryType + `">` +
+		`<ObjectID>` + id + `</ObjectID><BrowseFlag>` + flag + `</BrowseFlag>` +
+		`<Filter>*</Filter><StartingIndex>0</StartingIndex><RequestedCount>0</RequestedCount>` +
+		`<SortCriteria></SortCriteria></u:Browse></s:Body></s:Envelope>`
+	r := httptest.NewRequest(http.MethodPost, Prefix+controlPath+contentDirectoryService,
+		strings.NewReader(body))
+	r.Host = "proxy:8080"
+	r.Header.Set("SOAPACTION", `"`+contentDirectoryType+`#Browse"`)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Body.String()
+}
+
+type sourceT struct {
+	t     *testing.T
+	token string
+}
+
+func (s sourceT) Entries(r *http.Request, link string, options string,
+	_ logger.T) ([]extractor.InfoT, error) {
+	if link != "https://site.com/c" || options != "vf=m4a&token=abc" || r.Host != "proxy:8080" {
+		s.t.Error("Unexpected list request", r.Host, link, options)
+	}
+	return []extractor.InfoT{
+		{Title: "A & B", URL: "https://site.com/a", Duration: 3723.5},
+	}, nil
+}
+
+func (s sourceT) PlayLink(r *http.Request, link string, options string) string {
+	res := "http://" + r.Host + "/play?u=" + link
+	if options != "" {
+		res += "&" + options
+	}
+	return res
+}
+
+func (s sourceT) Authorize(_ *http.Request, token string) bool {
+	return token == s.token
+}
+
+func TestBrowse(t *testing.T) {
+	srv := &T{
+		name: "test",
+		uuid: "id",
+		containers: []ContainerT{
+			{Title: "Favorites", Items: []ItemT{{Title: "One", URL: "https://site.com/1"}}},
+			{Title: "Channel", URL: "https://site.com/c", Options: "vf=m4a&token=abc"},
+		},
+		source: sourceT{t: t},
+		log:    testLog(t),
+	}
+	for _, v := range []struct {
+		id, flag string
+		want     []string
+	}{
+		{rootID, "BrowseMetadata", []string{"<NumberReturned>1</NumberReturned>",
+			"childCount=&#34;2&#34;"}},
+		{rootID, "BrowseDirectChildren", []string{"<TotalMatches>2</TotalMatches>",
+			"Favorites", "Channel"}},
+		{"c0", "BrowseDirectChildren", []string{"http://proxy:8080/play?u=https://site.com/1",
+			"object.item.videoItem", "video/mp4"}},
+		{"c1", "BrowseDirectChildren", []string{"A &amp;amp; B",
+			"http://proxy:8080/play?u=https://site.com/a&amp;amp;vf=m4a&amp;amp;token=abc",
+			"audioItem", "1:02:03.500"}},
+		{"c1/0", "BrowseMetadata", []string{"<NumberReturned>1</NumberReturned>",
+			"id=&#34;c1/0&#34;"}},
+		{"c2", "BrowseDirectChildren", []string{"<errorCode>701</errorCode>"}},
+	} {
+		res := browse(t, srv, v.id, v.flag)
+		for _, s := range v.want {
+			if !strings.Contains(res, s) {
+				t.Errorf("For %s %s expected %q in\n%s", v.id, v.flag, s, res)
+			}
+		}
+	}
+}
+
+func TestAccess(t *testing.T) {
+	srv := &T{
+		name:   "test",
+		uuid:   "id",
+		token:  "tk",
+		base:   Prefix + "tk/",
+		source: sourceT{t: t, token: "tk"},
+		log:    testLog(t),
+	}
+	for _, v := range []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{Prefix + descriptionPath, http.StatusUnauthorized, ""},
+		{Prefix + "xx/" + descriptionPath, http.StatusUnauthorized, ""},
+		{Prefix + "tk/" + descriptionPath, http.StatusOK,
+			"<controlURL>/dlna/tk/control/ContentDirectory</controlURL>"},
+		{Prefix + "tk/" + contentDirectoryPath, http.StatusOK, "Browse"},
+	} {
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, v.path, nil))
+		if w.Code != v.status || !strings.Contains(w.Body.String(), v.body) {
+			t.Errorf("For %s expected %d %q, got %d\n%s", v.path, v.status, v.body,
+				w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package dlna
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	logger "ytproxy/logger"
+)
+
+const (
+	ssdpPort         = 1900
+	ssdpGroup        = "239.255.255.250"
+	maxAge           = 1800
+	announceInterval = 10 * time.Minute
+	rootDevice       = "upnp:rootdevice"
+	searchAll        = "ssdp:all"
+	discover         = `"ssdp:discover"`
+)
+
+var serverHeader = fmt.Sprintf("%s/1.0 UPnP/1.0 yt-proxy/1.0", runtime.GOOS)
+
+type ssdp struct {
+	conn     *net.UDPConn
+	send     *net.UDPConn
+	group    *net.UDPAddr
+	uuid     string
+	location string
+	log      logger.T
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// newSSDP listens for M-SEARCH requests and sends NOTIFY announces.
+// Interfaces without multicast support (loopback) answer unicast M-SEARCH only.
+func newSSDP(iface *net.Interface, ip net.IP, port int, uuid string,
+	location string, log logger.T) (*ssdp, error) {
+	s := &ssdp{
+		group:    &net.UDPAddr{IP: net.ParseIP(ssdpGroup), Port: port},
+		uuid:     uuid,
+		location: location,
+		log:      log,
+		done:     make(chan struct{}),
+	}
+	var err error
+	if iface.Flags&net.FlagMulticast != 0 {
+		s.conn, err = net.ListenMulticastUDP("udp4", iface, s.group)
+	} else {
+		log.LogWarning("Interface has no multicast support, only unicast M-SEARCH will be answered",
+			"interface", iface.Name)
+		s.conn, err = net.ListenUDP("udp4", &net.UDPAddr{IP: ip, Port: port})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ssdp listen: %s", err)
+	}
+	s.send, err = net.ListenUDP("udp4", &net.UDPAddr{IP: ip})
+	if err != nil {
+		_ = s.conn.Close()
+		return nil, fmt.Errorf("ssdp send socket: %s", err)
+	}
+	s.wg.Add(2)
+	go s.serve()
+	go s.announce(iface.Flags&net.FlagMulticast != 0)
+	return s, nil
+}
+
+func (s *ssdp) close() {
+	close(s.done)
+	if err := s.conn.Close(); err != nil {
+		s.log.LogError("ssdp close", "error", err)
+	}
+	s.wg.Wait()
+	if err := s.send.Close(); err != nil {
+		s.log.LogError("ssdp close", "error", err)
+	}
+}
+
+// targets lists notification types of device and its services
+func (s *ssdp) targets() []string {
+	return []string{
+		rootDevice,
+		"uuid:" + s.uuid,
+		deviceType,
+		contentDirectoryType,
+		connectionManagerType,
+	}
+}
+
+func (s *ssdp) usn(nt string) string {
+	if nt == "uuid:"+s.uuid {
+		return nt
+	}
+	return fmt.Sprintf("uuid:%s::%s", s.uuid, nt)
+}
+
+func (s *ssdp) serve() {
+	defer s.wg.Done()
+	buf := make([]byte, 4096)
+	for {
+		n, from, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			s.log.LogError("ssdp read", "error", err)
+			continue
+		}
+		for _, v := range s.handle(buf[:n]) {
+			if _, err := s.send.WriteToUDP(v, from); err != nil {
+				s.log.LogError("ssdp reply", "to", from, "error", err)
+			}
+		}
+	}
+}
+
+// handle parses packet and returns M-SEARCH replies
+func (s *ssdp) handle(packet []byte) [][]byte {
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(packet)))
+	if err != nil || req.Method != "M-SEARCH" || req.Header.Get("MAN") != discover {
+		return nil
+	}
+	st := req.Header.Get("ST")
+	res := make([][]byte, 0)
+	for _, v := range s.targets() {
+		if st == searchAll || st == v {
+			res = append(res, s.message("HTTP/1.1 200 OK", map[string]string{
+				"CACHE-CONTROL": fmt.Sprintf("max-age=%d", maxAge),
+				"DATE":          time.Now().UTC().Format(http.TimeFormat),
+				"EXT":           "",
+				"LOCATION":      s.location,
+				"SERVER":        serverHeader,
+				"ST":            v,
+				"USN":           s.usn(v),
+			}))
+		}
+	}
+	if len(res) > 0 {
+		s.log.LogDebug("M-SEARCH", "st", st, "replies", len(res))
+	}
+	return res
+}
+
+func (s *ssdp) notify(nts string) {
+	for _, v := range s.targets() {
+		headers := map[string]string{
+			"HOST": s.group.String(),
+			"NT":   v,
+			"NTS":  nts,
+			"USN":  s.usn(v),
+		}
+		if nts == "ssdp:alive" {
+			headers["CACHE-CONTROL"] = fmt.Sprintf("max-age=%d", maxAge)
+			headers["LOCATION"] = s.location
+			headers["SERVER"] = serverHeader
+		}
+		if _, err := s.send.WriteToUDP(s.message("NOTIFY * HTTP/1.1", headers),
+			s.group); err != nil {
+			s.log.LogError("ssdp notify", "error", err)
+			return
+		}
+	}
+}
+
+func (s *ssdp) announce(multicast bool) {
+	defer s.wg.Done()
+	if !multicast {
+		<-s.done
+		return
+	}
+	s.notify("ssdp:alive")
+	ticker := time.NewTicker(announceInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.notify("ssdp:alive")
+		case <-s.done:
+			s.notify("ssdp:byebye")
+			return
+		}
+	}
+}
+
+func (s *ssdp) message(first string, headers map[string]string) []byte {
+	var b strings.Builder
+	b.WriteString(first + "\r\n")
+	for _, k := range []string{"HOST", "CACHE-CONTROL", "DATE", "EXT", "LOCATION",
+		"NT", "NTS", "SERVER", "ST", "USN"} {
+		if v, ok := headers[k]; ok {
+			fmt.Fprintf(&b, "%s: %s\r\n", k, v)
+		}
+	}
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
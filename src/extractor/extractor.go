@@ -10,6 +10,9 @@ import (
 type T interface {
 	Extract(RequestT, logger.T) (ResultT, error)
 	GetUserAgent(logger.T) (string, error)
+	Playlist(RequestT, logger.T) (InfoT, error)
+	Search(SearchT, logger.T) (InfoT, error)
+	Info(RequestT, logger.T) (InfoT, error)
 }
 
 // ConfigT is constructor config type
@@ -20,6 +23,9 @@ type ConfigT struct {
 	GetUserAgent  *string   `json:"get-user-agent"`
 	CustomOptions *[]string `json:"custom-options"`
 	ForceHTTPS    *bool     `json:"force-https"`
+	Playlist      *string   `json:"playlist"`
+	Search        *string   `json:"search"`
+	Info          *string   `json:"info"`
 }
 
 // ResultT is extractor's result type
@@ -34,3 +40,53 @@ type RequestT struct {
 	HEIGHT string
 	FORMAT string
 }
+
+// SearchT is search request type for extractor
+type SearchT struct {
+	QUERY string
+	COUNT uint64
+}
+
+// InfoT is media or playlist metadata
+type InfoT struct {
+	ID          string
+	Title       string
+	URL         string
+	Thumbnail   string
+	Thumbnails  []ThumbnailT
+	Description string
+	Uploader    string
+	Published   time.Time
+	FileSize    int64
+	Duration    float64
+	IsLive      bool
+	Formats     []FormatT
+	Subtitles   []SubtitleT
+	Entries     []InfoT
+}
+
+// SubtitleT is subtitle track description,
+// Auto is set for automatic captions
+type SubtitleT struct {
+	Lang string
+	Name string
+	Ext  string
+	URL  string
+	Auto bool
+}
+
+// ThumbnailT is thumbnail image description
+type ThumbnailT struct {
+	URL    string
+	Width  uint64
+	Height uint64
+}
+
+// FormatT is media format description
+type FormatT struct {
+	ID     string
+	Ext    string
+	Height uint64
+	VCodec string
+	ACodec string
+}
@@ -17,7 +17,7 @@ import (
 
 // New creates new default extractor implementation
 func New(path string, mp4, m4a []string, getUserAgent string,
-	customOptions []string) (extractor.T, error) {
+	customOptions []string, playlist, search, info []string) (extractor.T, error) {
 	var (
 		e   defaultExtractor
 		err error
@@ -45,6 +45,18 @@ func New(path string, mp4, m4a []string, getUserAgent string,
 	if err != nil {
 		return &e, err
 	}
+	e.playlist, err = read(playlist)
+	if err != nil {
+		return &e, err
+	}
+	e.search, err = read(search)
+	if err != nil {
+		return &e, err
+	}
+	e.info, err = read(info)
+	if err != nil {
+		return &e, err
+	}
 	e.getUserAgent = getUserAgent
 	e.path = path
 	return &e, nil
@@ -56,6 +68,9 @@ type defaultExtractor struct {
 	mp4           []*template.Template
 	m4a           []*template.Template
 	customOptions []*template.Template
+	playlist      []*template.Template
+	search        []*template.Template
+	info          []*template.Template
 	getUserAgent  string
 }
 
@@ -69,44 +84,94 @@ func (t *defaultExtractor) Extract(req extractor.RequestT, log logger.T,
 ) (extractor.ResultT, error) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
-	var (
-		buf        []string
-		bufOptions []string
-		err        error
-	)
-	execute := func(list []*template.Template) ([]string, error) {
-		buf := make([]string, 0)
-		for _, v := range list {
-			var b bytes.Buffer
-			err = v.Execute(&b, req)
-			if err != nil {
-				return buf, err
-			}
-			buf = append(buf, bytesToString(b))
-		}
-		return buf, nil
-	}
+	var list []*template.Template
 	switch req.FORMAT {
 	case "m4a":
-		buf, err = execute(t.m4a)
+		list = t.m4a
 	case "mp4":
 		fallthrough
 	default:
-		buf, err = execute(t.mp4)
+		list = t.mp4
 	}
+	args, err := t.args(list, req)
 	if err != nil {
 		return extractor.ResultT{}, err
 	}
-	bufOptions, err = execute(t.customOptions)
+	out, err := t.runCmd(args, log)
 	if err != nil {
 		return extractor.ResultT{}, err
 	}
-	bufOptions = append(bufOptions, buf...)
-	out, err := t.runCmd(bufOptions, log)
+	return extractor.ResultT{URL: out}, err
+}
+
+func (t *defaultExtractor) Playlist(req extractor.RequestT, log logger.T,
+) (extractor.InfoT, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	args, err := t.args(t.playlist, req)
+	if err != nil {
+		return extractor.InfoT{}, err
+	}
+	out, err := t.runCmd(args, log)
 	if err != nil {
-		return extractor.ResultT{}, err
+		return extractor.InfoT{}, err
 	}
-	return extractor.ResultT{URL: out}, err
+	return parseInfo(out)
+}
+
+func (t *defaultExtractor) Search(req extractor.SearchT, log logger.T,
+) (extractor.InfoT, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	args, err := t.args(t.search, req)
+	if err != nil {
+		return extractor.InfoT{}, err
+	}
+	out, err := t.runCmd(args, log)
+	if err != nil {
+		return extractor.InfoT{}, err
+	}
+	return parseInfo(out)
+}
+
+func (t *defaultExtractor) Info(req extractor.RequestT, log logger.T,
+) (extractor.InfoT, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	args, err := t.args(t.info, req)
+	if err != nil {
+		return extractor.InfoT{}, err
+	}
+	out, err := t.runCmd(args, log)
+	if err != nil {
+		return extractor.InfoT{}, err
+	}
+	return parseInfo(out)
+}
+
+// args executes custom options and list templates with req as data
+func (t *defaultExtractor) args(list []*template.Template,
+	req any) ([]string, error) {
+	execute := func(list []*template.Template) ([]string, error) {
+		buf := make([]string, 0)
+		for _, v := range list {
+			var b bytes.Buffer
+			if err := v.Execute(&b, req); err != nil {
+				return buf, err
+			}
+			buf = append(buf, bytesToString(b))
+		}
+		return buf, nil
+	}
+	buf, err := execute(list)
+	if err != nil {
+		return nil, err
+	}
+	bufOptions, err := execute(t.customOptions)
+	if err != nil {
+		return nil, err
+	}
+	return append(bufOptions, buf...), nil
 }
 
 func (t *defaultExtractor) runCmd(args []string, log logger.T) (string, error) {
@@ -0,0 +1,138 @@
+package dedfaultextractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	extractor "ytproxy/extractor"
+)
+
+// ytdlpInfo is part of yt-dlp's --dump-single-json output,
+// numbers are float64 because some extractors return fractional values
+type ytdlpInfo struct {
+	ID             string  `json:"id"`
+	Title          string  `json:"title"`
+	URL            string  `json:"url"`
+	WebpageURL     string  `json:"webpage_url"`
+	Thumbnail      string  `json:"thumbnail"`
+	Description    string  `json:"description"`
+	Uploader       string  `json:"uploader"`
+	Channel        string  `json:"channel"`
+	Timestamp      float64 `json:"timestamp"`
+	UploadDate     string  `json:"upload_date"`
+	FileSize       float64 `json:"filesize"`
+	FileSizeApprox float64 `json:"filesize_approx"`
+	Duration       float64 `json:"duration"`
+	IsLive         bool    `json:"is_live"`
+	Formats        []struct {
+		ID     string  `json:"format_id"`
+		Ext    string  `json:"ext"`
+		Height float64 `json:"height"`
+		VCodec string  `json:"vcodec"`
+		ACodec string  `json:"acodec"`
+	} `json:"formats"`
+	Subtitles         map[string][]ytdlpSubtitle `json:"subtitles"`
+	AutomaticCaptions map[string][]ytdlpSubtitle `json:"automatic_captions"`
+	Thumbnails        []struct {
+		URL    string  `json:"url"`
+		Width  float64 `json:"width"`
+		Height float64 `json:"height"`
+	} `json:"thumbnails"`
+	Entries []ytdlpInfo `json:"entries"`
+}
+
+type ytdlpSubtitle struct {
+	Ext  string `json:"ext"`
+	URL  string `json:"url"`
+	Name string `json:"name"`
+}
+
+func parseInfo(out string) (extractor.InfoT, error) {
+	var v ytdlpInfo
+	if err := json.Unmarshal([]byte(out), &v); err != nil {
+		return extractor.InfoT{}, fmt.Errorf("extractor json parse: %s", err)
+	}
+	return v.info(), nil
+}
+
+func (v ytdlpInfo) info() extractor.InfoT {
+	res := extractor.InfoT{
+		ID:          v.ID,
+		Title:       v.Title,
+		URL:         v.WebpageURL,
+		Thumbnail:   v.Thumbnail,
+		Description: v.Description,
+		Uploader:    v.Uploader,
+		FileSize:    int64(v.FileSize),
+		Duration:    v.Duration,
+		IsLive:      v.IsLive,
+	}
+	if res.Uploader == "" {
+		res.Uploader = v.Channel
+	}
+	if res.FileSize == 0 {
+		res.FileSize = int64(v.FileSizeApprox)
+	}
+	switch {
+	case v.Timestamp > 0:
+		res.Published = time.Unix(int64(v.Timestamp), 0).UTC()
+	case v.UploadDate != "":
+		// YYYYMMDD
+		if d, err := time.Parse("20060102", v.UploadDate); err == nil {
+			res.Published = d
+		}
+	}
+	// flat playlist entries have url set to webpage
+	if res.URL == "" {
+		res.URL = v.URL
+	}
+	// best thumbnail is the last one
+	if res.Thumbnail == "" && len(v.Thumbnails) > 0 {
+		res.Thumbnail = v.Thumbnails[len(v.Thumbnails)-1].URL
+	}
+	for _, t := range v.Thumbnails {
+		res.Thumbnails = append(res.Thumbnails, extractor.ThumbnailT{
+			URL:    t.URL,
+			Width:  uint64(t.Width),
+			Height: uint64(t.Height),
+		})
+	}
+	subtitles := func(list map[string][]ytdlpSubtitle, auto bool) {
+		langs := make([]string, 0, len(list))
+		for k := range list {
+			langs = append(langs, k)
+		}
+		sort.Strings(langs)
+		for _, lang := range langs {
+			for _, s := range list[lang] {
+				res.Subtitles = append(res.Subtitles, extractor.SubtitleT{
+					Lang: lang,
+					Name: s.Name,
+					Ext:  s.Ext,
+					URL:  s.URL,
+					Auto: auto,
+				})
+			}
+		}
+	}
+	subtitles(v.Subtitles, false)
+	subtitles(v.AutomaticCaptions, true)
+	for _, f := range v.Formats {
+		res.Formats = append(res.Formats, extractor.FormatT{
+			ID:     f.ID,
+			Ext:    f.Ext,
+			Height: uint64(f.Height),
+			VCodec: f.VCodec,
+			ACodec: f.ACodec,
+		})
+	}
+	if v.Entries != nil {
+		res.Entries = make([]extractor.InfoT, 0, len(v.Entries))
+		for _, e := range v.Entries {
+			res.Entries = append(res.Entries, e.info())
+		}
+	}
+	return res
+}
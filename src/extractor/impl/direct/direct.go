@@ -3,6 +3,8 @@
 package directextractor
 
 import (
+	"fmt"
+
 	extractor "ytproxy/extractor"
 	logger "ytproxy/logger"
 )
@@ -23,3 +25,18 @@ func (t *directExtractor) Extract(req extractor.RequestT, _ logger.T,
 ) (extractor.ResultT, error) {
 	return extractor.ResultT{URL: req.URL}, nil
 }
+
+func (t *directExtractor) Playlist(_ extractor.RequestT, _ logger.T,
+) (extractor.InfoT, error) {
+	return extractor.InfoT{}, fmt.Errorf("playlists are not supported by direct extractor")
+}
+
+func (t *directExtractor) Search(_ extractor.SearchT, _ logger.T,
+) (extractor.InfoT, error) {
+	return extractor.InfoT{}, fmt.Errorf("search is not supported by direct extractor")
+}
+
+func (t *directExtractor) Info(_ extractor.RequestT, _ logger.T,
+) (extractor.InfoT, error) {
+	return extractor.InfoT{}, fmt.Errorf("metadata is not supported by direct extractor")
+}
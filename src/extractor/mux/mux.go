@@ -38,6 +38,24 @@ func (t *layer) Extract(req extractor.RequestT, log logger.T) (extractor.ResultT
 	return t.impl.Extract(req, log)
 }
 
+func (t *layer) Playlist(req extractor.RequestT, log logger.T) (extractor.InfoT, error) {
+	if t.forceHTTP {
+		req.URL = "https://" + req.URL
+	}
+	return t.impl.Playlist(req, log)
+}
+
+func (t *layer) Search(req extractor.SearchT, log logger.T) (extractor.InfoT, error) {
+	return t.impl.Search(req, log)
+}
+
+func (t *layer) Info(req extractor.RequestT, log logger.T) (extractor.InfoT, error) {
+	if t.forceHTTP {
+		req.URL = "https://" + req.URL
+	}
+	return t.impl.Info(req, log)
+}
+
 func (t *layer) GetUserAgent(log logger.T) (string, error) {
 	return t.impl.GetUserAgent(log)
 }
@@ -57,6 +75,9 @@ func realNew(c extractor.ConfigT) (extractor.T, error) {
 			split(*c.M4A),
 			*c.GetUserAgent,
 			co,
+			split(*c.Playlist),
+			split(*c.Search),
+			split(*c.Info),
 		)
 	}
 }
@@ -0,0 +1,295 @@
+// Package limiter contains per client rate limits and concurrent streams caps
+package limiter
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// StreamsRetryAfter is suggested retry time when streams cap is reached
+	StreamsRetryAfter = 5 * time.Second
+	cleanInterval     = 10 * time.Minute
+)
+
+// ConfigT is limiter config, zero values disable limits
+type ConfigT struct {
+	PlayRate      *float64 `json:"play-rate"`
+	PlayBurst     *uint64  `json:"play-burst"`
+	ExtractRate   *float64 `json:"extract-rate"`
+	ExtractBurst  *uint64  `json:"extract-burst"`
+	ClientStreams *uint64  `json:"client-streams"`
+	Streams       *uint64  `json:"streams"`
+	ErrorMedia    *bool    `json:"error-media"`
+	// Bandwidth is KiB/s of all streams, BandwidthBurst is KiB
+	Bandwidth      *uint64 `json:"bandwidth"`
+	BandwidthBurst *uint64 `json:"bandwidth-burst"`
+}
+
+// LimitError is returned for limited requests
+type LimitError struct {
+	Limit      string
+	Client     string
+	State      string
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s limit reached for %s (%s), retry after %s",
+		e.Limit, e.Client, e.State, e.RetryAfter)
+}
+
+// RetryAfterSeconds returns Retry-After header value
+func (e *LimitError) RetryAfterSeconds() string {
+	return fmt.Sprintf("%d", int64(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+// T is limiter instance, nil T does not limit anything.
+// mu guards limits too, they are changed by Update
+type T struct {
+	mu            sync.Mutex
+	play          *bucketsT
+	extract       *bucketsT
+	clientStreams uint64
+	streams       uint64
+	errorMedia    bool
+	active        map[string]uint64
+	running       uint64
+}
+
+// New creates limiter, rates are per minute.
+// Returns nil if all limits are disabled
+func New(conf ConfigT) *T {
+	if *conf.PlayRate <= 0 && *conf.ExtractRate <= 0 &&
+		*conf.ClientStreams == 0 && *conf.Streams == 0 {
+		return nil
+	}
+	return &T{
+		play:          newBuckets(*conf.PlayRate/60, requests(*conf.PlayBurst)),
+		extract:       newBuckets(*conf.ExtractRate/60, requests(*conf.ExtractBurst)),
+		clientStreams: *conf.ClientStreams,
+		streams:       *conf.Streams,
+		errorMedia:    *conf.ErrorMedia,
+		active:        make(map[string]uint64),
+	}
+}
+
+// Update applies conf limits to t keeping client buckets and active streams,
+// so config reload does not reset them. Nil t is created,
+// nil is returned if all limits are disabled
+func (t *T) Update(conf ConfigT) *T {
+	n := New(conf)
+	if t == nil || n == nil {
+		return n
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.play = t.play.update(n.play)
+	t.extract = t.extract.update(n.extract)
+	t.clientStreams = n.clientStreams
+	t.streams = n.streams
+	t.errorMedia = n.errorMedia
+	return t
+}
+
+// ErrorMedia tells if limited play requests get error media instead of 429
+func (t *T) ErrorMedia() bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.errorMedia
+}
+
+// buckets returns current play and extract buckets
+func (t *T) buckets() (*bucketsT, *bucketsT) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.play, t.extract
+}
+
+// Play takes play request token of client
+func (t *T) Play(client string, now time.Time) error {
+	if t == nil {
+		return nil
+	}
+	play, _ := t.buckets()
+	return play.take("play rate", client, now)
+}
+
+// Extract takes extractor invocation token of client
+func (t *T) Extract(client string, now time.Time) error {
+	if t == nil {
+		return nil
+	}
+	_, extract := t.buckets()
+	return extract.take("extract rate", client, now)
+}
+
+// Stream registers client stream, release must be called when it ends
+func (t *T) Stream(client string) (func(), error) {
+	if t == nil {
+		return func() {}, nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	limit := func(name string) error {
+		return &LimitError{
+			Limit:  name,
+			Client: client,
+			State: fmt.Sprintf("client streams %d/%d, streams %d/%d",
+				t.active[client], t.clientStreams, t.running, t.streams),
+			RetryAfter: StreamsRetryAfter,
+		}
+	}
+	if t.streams > 0 && t.running >= t.streams {
+		return nil, limit("streams")
+	}
+	if t.clientStreams > 0 && t.active[client] >= t.clientStreams {
+		return nil, limit("client streams")
+	}
+	t.active[client]++
+	t.running++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.running--
+			if t.active[client]--; t.active[client] == 0 {
+				delete(t.active, client)
+			}
+		})
+	}, nil
+}
+
+// State describes client limiter state for logs
+func (t *T) State(client string, now time.Time) string {
+	if t == nil {
+		return "disabled"
+	}
+	t.mu.Lock()
+	play, extract := t.play, t.extract
+	streams := fmt.Sprintf("client streams %d/%d, streams %d/%d",
+		t.active[client], t.clientStreams, t.running, t.streams)
+	t.mu.Unlock()
+	return fmt.Sprintf("play %s, extract %s, %s",
+		play.state(client, now), extract.state(client, now), streams)
+}
+
+type bucketT struct {
+	tokens float64
+	last   time.Time
+}
+
+// bucketsT is token buckets by client
+type bucketsT struct {
+	rate    float64 // tokens per second
+	burst   float64
+	mu      sync.Mutex
+	list    map[string]*bucketT
+	cleaned time.Time
+}
+
+// requests returns requests burst, at least one
+func requests(burst uint64) float64 {
+	if burst == 0 {
+		return 1
+	}
+	return float64(burst)
+}
+
+// newBuckets creates buckets, rate is tokens per second
+func newBuckets(rate float64, burst float64) *bucketsT {
+	if rate <= 0 {
+		return nil
+	}
+	return &bucketsT{
+		rate:  rate,
+		burst: burst,
+		list:  make(map[string]*bucketT),
+	}
+}
+
+// update applies rate and burst of n keeping client buckets,
+// nil buckets are replaced
+func (t *bucketsT) update(n *bucketsT) *bucketsT {
+	if t == nil || n == nil {
+		return n
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rate = n.rate
+	t.burst = n.burst
+	for _, v := range t.list {
+		v.tokens = math.Min(v.tokens, t.burst)
+	}
+	return t
+}
+
+// refill returns client bucket with tokens added since last use
+func (t *bucketsT) refill(client string, now time.Time) *bucketT {
+	if now.Sub(t.cleaned) > cleanInterval {
+		// full buckets are the same as absent ones
+		for k, v := range t.list {
+			if now.Sub(v.last).Seconds()*t.rate+v.tokens >= t.burst {
+				delete(t.list, k)
+			}
+		}
+		t.cleaned = now
+	}
+	b, ok := t.list[client]
+	if !ok {
+		b = &bucketT{tokens: t.burst, last: now}
+		t.list[client] = b
+	}
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(t.burst, b.tokens+elapsed*t.rate)
+		b.last = now
+	}
+	return b
+}
+
+func (t *bucketsT) take(name, client string, now time.Time) error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := t.refill(client, now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return nil
+	}
+	return &LimitError{
+		Limit:      name,
+		Client:     client,
+		State:      fmt.Sprintf("%.2f/%.0f tokens", b.tokens, t.burst),
+		RetryAfter: time.Duration((1 - b.tokens) / t.rate * float64(time.Second)),
+	}
+}
+
+// reserve takes n tokens, possibly in debt,
+// and returns time to wait until debt is paid
+func (t *bucketsT) reserve(client string, n int, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := t.refill(client, now)
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / t.rate * float64(time.Second))
+}
+
+func (t *bucketsT) state(client string, now time.Time) string {
+	if t == nil {
+		return "unlimited"
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return fmt.Sprintf("%.2f/%.0f tokens", t.refill(client, now).tokens, t.burst)
+}
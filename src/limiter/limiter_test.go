@@ -0,0 +1,127 @@
+package limiter
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newConfig(playRate float64, playBurst, clientStreams, streams uint64) ConfigT {
+	var (
+		zr  float64
+		fls bool
+	)
+	return ConfigT{
+		PlayRate:      &playRate,
+		PlayBurst:     &playBurst,
+		ExtractRate:   &zr,
+		ExtractBurst:  new(uint64),
+		ClientStreams: &clientStreams,
+		Streams:       &streams,
+		ErrorMedia:    &fls,
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	l := New(newConfig(0, 0, 0, 0))
+	if l != nil {
+		t.Fatal("expected nil limiter")
+	}
+	if err := l.Play("a", time.Now()); err != nil {
+		t.Error(err)
+	}
+	release, err := l.Stream("a")
+	if err != nil {
+		t.Error(err)
+	}
+	release()
+}
+
+func TestPlayRate(t *testing.T) {
+	l := New(newConfig(60, 2, 0, 0))
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if err := l.Play("a", now); err != nil {
+			t.Fatal("burst", i, err)
+		}
+	}
+	err := l.Play("a", now)
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatal("expected limit error, got", err)
+	}
+	if r := limitErr.RetryAfterSeconds(); r != "1" {
+		t.Error("expected retry after 1, got", r)
+	}
+	if err := l.Play("b", now); err != nil {
+		t.Error("other client limited", err)
+	}
+	if err := l.Play("a", now.Add(time.Second)); err != nil {
+		t.Error("expected refill, got", err)
+	}
+	if err := l.Extract("a", now); err != nil {
+		t.Error("extract is unlimited, got", err)
+	}
+}
+
+func TestStreams(t *testing.T) {
+	l := New(newConfig(0, 0, 1, 2))
+	releaseA, err := l.Stream("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Stream("a"); err == nil {
+		t.Error("expected client streams limit")
+	}
+	releaseB, err := l.Stream("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Stream("c"); err == nil {
+		t.Error("expected streams limit")
+	}
+	releaseA()
+	releaseA()
+	if _, err := l.Stream("c"); err != nil {
+		t.Error("expected free slot, got", err)
+	}
+	releaseB()
+	if _, err := l.Stream("a"); err != nil {
+		t.Error("expected free slot, got", err)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	l := New(newConfig(60, 1, 1, 0))
+	now := time.Now()
+	if err := l.Play("a", now); err != nil {
+		t.Fatal(err)
+	}
+	release, err := l.Stream("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u := l.Update(newConfig(60, 3, 1, 0)); u != l {
+		t.Fatal("expected same limiter")
+	}
+	if err := l.Play("a", now); err == nil {
+		t.Error("expected play bucket to survive update")
+	}
+	if _, err := l.Stream("a"); err == nil {
+		t.Error("expected active stream to survive update")
+	}
+	release()
+	if _, err := l.Stream("a"); err != nil {
+		t.Error("expected free slot, got", err)
+	}
+	if err := l.Update(newConfig(0, 0, 1, 0)).Play("a", now); err != nil {
+		t.Error("expected disabled play rate, got", err)
+	}
+	if l.Update(newConfig(0, 0, 0, 0)) != nil {
+		t.Error("expected nil limiter")
+	}
+	var n *T
+	if n.Update(newConfig(60, 1, 0, 0)) == nil {
+		t.Error("expected new limiter")
+	}
+}
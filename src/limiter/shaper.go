@@ -0,0 +1,130 @@
+package limiter
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	kib = 1024
+	// defaultBurstTime is burst size in rate seconds when burst is not set
+	defaultBurstTime = 5
+	maxChunk         = 32 * kib
+)
+
+// ShaperT limits output bandwidth of all streams and of every client.
+// Streams get tokens from global bucket and from client bucket,
+// full buckets let player's initial buffering go at full speed
+type ShaperT struct {
+	global *bucketsT
+	mu     sync.Mutex
+	// clients are client buckets by rate and burst,
+	// sub-configs with equal limits share them
+	clients map[[2]uint64]*bucketsT
+}
+
+// NewShaper creates shaper with global limit from conf
+func NewShaper(conf ConfigT) *ShaperT {
+	return &ShaperT{
+		global:  newBuckets(bandwidth(*conf.Bandwidth, *conf.BandwidthBurst)),
+		clients: make(map[[2]uint64]*bucketsT),
+	}
+}
+
+// bandwidth returns bytes rate and burst of KiB config values
+func bandwidth(rate, burst uint64) (float64, float64) {
+	if burst == 0 {
+		burst = rate * defaultBurstTime
+	}
+	return float64(rate * kib), float64(burst * kib)
+}
+
+// Writer returns w shaped by global and client limits, rate is KiB/s,
+// burst is KiB. Writes fail when ctx is done while waiting
+func (t *ShaperT) Writer(ctx context.Context, w io.Writer, client string,
+	rate, burst uint64) io.Writer {
+	if t == nil {
+		return w
+	}
+	res := &writerT{ctx: ctx, w: w, chunk: maxChunk}
+	if t.global != nil {
+		res.add(t.global, "")
+	}
+	if rate > 0 {
+		t.mu.Lock()
+		b, ok := t.clients[[2]uint64{rate, burst}]
+		if !ok {
+			b = newBuckets(bandwidth(rate, burst))
+			t.clients[[2]uint64{rate, burst}] = b
+		}
+		t.mu.Unlock()
+		res.add(b, client)
+	}
+	if len(res.buckets) == 0 {
+		return w
+	}
+	return res
+}
+
+type writerT struct {
+	ctx     context.Context
+	w       io.Writer
+	buckets []*bucketsT
+	keys    []string
+	chunk   int
+}
+
+func (t *writerT) add(b *bucketsT, key string) {
+	t.buckets = append(t.buckets, b)
+	t.keys = append(t.keys, key)
+	// chunk must fit into every bucket
+	if int(b.burst) < t.chunk {
+		t.chunk = int(b.burst)
+	}
+	if t.chunk < 1 {
+		t.chunk = 1
+	}
+}
+
+func (t *writerT) Write(p []byte) (int, error) {
+	var n int
+	for len(p) > 0 {
+		chunk := len(p)
+		if chunk > t.chunk {
+			chunk = t.chunk
+		}
+		var wait time.Duration
+		now := time.Now()
+		for k, v := range t.buckets {
+			if d := v.reserve(t.keys[k], chunk, now); d > wait {
+				wait = d
+			}
+		}
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-t.ctx.Done():
+				timer.Stop()
+				return n, t.ctx.Err()
+			case <-timer.C:
+			}
+		}
+		m, err := t.w.Write(p[:chunk])
+		n += m
+		if err != nil {
+			return n, err
+		}
+		p = p[chunk:]
+	}
+	return n, nil
+}
+
+// Flush implements http.Flusher
+func (t *writerT) Flush() {
+	if f, ok := t.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
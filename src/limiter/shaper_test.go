@@ -0,0 +1,62 @@
+package limiter
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReserve(t *testing.T) {
+	b := newBuckets(bandwidth(1, 2))
+	now := time.Now()
+	if d := b.reserve("a", 2*kib, now); d != 0 {
+		t.Error("expected burst without wait, got", d)
+	}
+	if d := b.reserve("a", kib, now); d != time.Second {
+		t.Error("expected 1s wait, got", d)
+	}
+	if d := b.reserve("b", kib, now); d != 0 {
+		t.Error("expected other client without wait, got", d)
+	}
+	if d := b.reserve("a", kib, now.Add(2*time.Second)); d != 0 {
+		t.Error("expected paid debt, got", d)
+	}
+}
+
+func TestShaperWriter(t *testing.T) {
+	zn := uint64(0)
+	s := NewShaper(ConfigT{Bandwidth: &zn, BandwidthBurst: &zn})
+	var buf bytes.Buffer
+	if w := s.Writer(context.Background(), &buf, "a", 0, 0); w != &buf {
+		t.Error("expected unlimited writer")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	w := s.Writer(ctx, &buf, "a", 1, 1)
+	if n, err := w.Write(make([]byte, kib)); n != kib || err != nil {
+		t.Fatal("expected burst write, got", n, err)
+	}
+	cancel()
+	if n, err := w.Write(make([]byte, kib)); n != 0 || err == nil {
+		t.Error("expected canceled write, got", n, err)
+	}
+	if buf.Len() != kib {
+		t.Error("expected", kib, "bytes written, got", buf.Len())
+	}
+}
+
+func TestShaperFlush(t *testing.T) {
+	zn := uint64(0)
+	s := NewShaper(ConfigT{Bandwidth: &zn, BandwidthBurst: &zn})
+	rec := httptest.NewRecorder()
+	w := s.Writer(context.Background(), rec, "a", 1, 1)
+	f, ok := w.(interface{ Flush() })
+	if !ok {
+		t.Fatal("expected flusher")
+	}
+	f.Flush()
+	if !rec.Flushed {
+		t.Error("expected flush passed to underlying writer")
+	}
+}
@@ -0,0 +1,301 @@
+// Package accesslog writes one line per request
+// in Apache combined log format or as JSON lines
+package accesslog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	logger "ytproxy/logger"
+	rotate "ytproxy/logger/rotate"
+)
+
+const (
+	stdout     = "stdout"
+	timeFormat = "02/Jan/2006:15:04:05 -0700"
+	// redacted options are not written to access log
+	redactedOption = "token"
+)
+
+// EntryT is request details known only to request handler
+type EntryT struct {
+	mu          sync.Mutex
+	user        string
+	subConfig   string
+	cache       string
+	extractTime time.Duration
+}
+
+type entryKey struct{}
+
+// Entry returns request access log entry, nil if access log is disabled
+func Entry(ctx context.Context) *EntryT {
+	e, _ := ctx.Value(entryKey{}).(*EntryT)
+	return e
+}
+
+// SetUser sets authorized user name (token label)
+func (t *EntryT) SetUser(user string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.user = user
+	t.mu.Unlock()
+}
+
+// SetSubConfig sets sub-config serving request
+func (t *EntryT) SetSubConfig(name string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.subConfig = name
+	t.mu.Unlock()
+}
+
+// SetCacheHit sets if link was cached
+func (t *EntryT) SetCacheHit(hit bool) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.cache = "miss"
+	if hit {
+		t.cache = "hit"
+	}
+	t.mu.Unlock()
+}
+
+// AddExtractTime adds extractor invocation time
+func (t *EntryT) AddExtractTime(d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.extractTime += d
+	t.mu.Unlock()
+}
+
+// T is access logger, nil T logs nothing
+type T struct {
+	mu     sync.Mutex
+	out    io.Writer
+	file   *rotate.T
+	format logger.AccessFormatT
+}
+
+// New creates access logger, returns nil if it is disabled
+func New(conf logger.ConfigT) (*T, error) {
+	switch *conf.AccessLog {
+	case "":
+		return nil, nil
+	case stdout:
+		return &T{out: os.Stdout, format: *conf.AccessFormat}, nil
+	}
+	f, err := conf.Open(*conf.AccessLog)
+	if err != nil {
+		return nil, err
+	}
+	return &T{out: f, file: f, format: *conf.AccessFormat}, nil
+}
+
+// Close closes access log file
+func (t *T) Close() error {
+	if t == nil || t.file == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.file.Close()
+}
+
+// recordT is request record
+type recordT struct {
+	Time        time.Time
+	Client      string
+	User        string
+	Method      string
+	URI         string
+	Proto       string
+	Status      int
+	Bytes       int64
+	Referer     string
+	UserAgent   string
+	SubConfig   string
+	Cache       string
+	ExtractTime time.Duration
+	Duration    time.Duration
+}
+
+// Handler logs requests served by next. strip removes secrets from request uri
+// (token options are always redacted)
+func (t *T) Handler(next http.Handler, strip func(string) string) http.Handler {
+	if t == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		uri := redact(strip(r.RequestURI))
+		entry := &EntryT{}
+		r = r.WithContext(context.WithValue(r.Context(), entryKey{}, entry))
+		rec := &recorderT{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		entry.mu.Lock()
+		defer entry.mu.Unlock()
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		client := r.RemoteAddr
+		if host, _, err := net.SplitHostPort(client); err == nil {
+			client = host
+		}
+		t.write(recordT{
+			Time:        start,
+			Client:      client,
+			User:        entry.user,
+			Method:      r.Method,
+			URI:         uri,
+			Proto:       r.Proto,
+			Status:      rec.status,
+			Bytes:       rec.bytes,
+			Referer:     r.Referer(),
+			UserAgent:   r.UserAgent(),
+			SubConfig:   entry.subConfig,
+			Cache:       entry.cache,
+			ExtractTime: entry.extractTime,
+			Duration:    time.Since(start),
+		})
+	})
+}
+
+func (t *T) write(rec recordT) {
+	var line string
+	if t.format == logger.JSONLines {
+		b, err := json.Marshal(struct {
+			Time        string  `json:"time"`
+			Client      string  `json:"client"`
+			User        string  `json:"user,omitempty"`
+			Method      string  `json:"method"`
+			URI         string  `json:"uri"`
+			Proto       string  `json:"proto"`
+			Status      int     `json:"status"`
+			Bytes       int64   `json:"bytes"`
+			Referer     string  `json:"referer,omitempty"`
+			UserAgent   string  `json:"user-agent,omitempty"`
+			SubConfig   string  `json:"sub-config,omitempty"`
+			Cache       string  `json:"cache,omitempty"`
+			ExtractTime float64 `json:"extract-time"`
+			Duration    float64 `json:"duration"`
+		}{rec.Time.Format(time.RFC3339Nano), rec.Client, rec.User, rec.Method, rec.URI,
+			rec.Proto, rec.Status, rec.Bytes, rec.Referer, rec.UserAgent, rec.SubConfig,
+			rec.Cache, rec.ExtractTime.Seconds(), rec.Duration.Seconds()})
+		if err != nil {
+			return
+		}
+		line = string(b) + "\n"
+	} else {
+		line = combined(rec)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, _ = io.WriteString(t.out, line)
+}
+
+// combined formats record as Apache combined log line
+// with sub-config, cache, extractor time and duration (seconds) fields appended
+func combined(rec recordT) string {
+	bytes := "-"
+	if rec.Bytes > 0 {
+		bytes = fmt.Sprintf("%d", rec.Bytes)
+	}
+	return fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s \"%s\" \"%s\" \"%s\" %s %.3f %.3f\n",
+		dash(rec.Client), dash(escape(rec.User)), rec.Time.Format(timeFormat),
+		escape(rec.Method), escape(rec.URI), escape(rec.Proto), rec.Status, bytes,
+		dash(escape(rec.Referer)), dash(escape(rec.UserAgent)), dash(escape(rec.SubConfig)),
+		dash(rec.Cache), rec.ExtractTime.Seconds(), rec.Duration.Seconds())
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// escape escapes quotes, backslashes and control characters like Apache does
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&b, "\\x%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// redact hides token option values
+func redact(uri string) string {
+	path, query, ok := strings.Cut(uri, "?")
+	if !ok || !strings.Contains(query, redactedOption+"=") {
+		return uri
+	}
+	parts := strings.Split(query, "&")
+	for k, v := range parts {
+		if name, _, ok := strings.Cut(v, "="); ok {
+			if n, err := url.QueryUnescape(name); err == nil && n == redactedOption {
+				parts[k] = name + "=-"
+			}
+		}
+	}
+	return path + "?" + strings.Join(parts, "&")
+}
+
+type recorderT struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (t *recorderT) WriteHeader(status int) {
+	if t.status == 0 {
+		t.status = status
+	}
+	t.ResponseWriter.WriteHeader(status)
+}
+
+func (t *recorderT) Write(b []byte) (int, error) {
+	if t.status == 0 {
+		t.status = http.StatusOK
+	}
+	n, err := t.ResponseWriter.Write(b)
+	t.bytes += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher
+func (t *recorderT) Flush() {
+	if f, ok := t.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns original writer for http.ResponseController
+func (t *recorderT) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
@@ -0,0 +1,81 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	logger "ytproxy/logger"
+)
+
+func TestRedact(t *testing.T) {
+	for k, v := range map[string]string{
+		"/play/youtu.be/x":                    "/play/youtu.be/x",
+		"/play?u=a&token=abc&vh=360":          "/play?u=a&token=-&vh=360",
+		"/play/youtu.be/x?/?vh=360&token=abc": "/play/youtu.be/x?/?vh=360&token=-",
+		"/search/?q=token%3Dabc":              "/search/?q=token%3Dabc",
+	} {
+		if r := redact(k); r != v {
+			t.Error("For", k, "expected", v, "got", r)
+		}
+	}
+}
+
+func TestCombined(t *testing.T) {
+	rec := recordT{
+		Time:        time.Date(2024, 10, 12, 13, 55, 36, 0, time.FixedZone("", -7*3600)),
+		Client:      "1.2.3.4",
+		Method:      "GET",
+		URI:         `/play?u=a"b`,
+		Proto:       "HTTP/1.1",
+		Status:      200,
+		Bytes:       2326,
+		UserAgent:   "VLC\n",
+		SubConfig:   "default",
+		Cache:       "hit",
+		ExtractTime: 1500 * time.Millisecond,
+		Duration:    2 * time.Second,
+	}
+	want := `1.2.3.4 - - [12/Oct/2024:13:55:36 -0700] "GET /play?u=a\"b HTTP/1.1" 200 2326` +
+		` "-" "VLC\x0a" "default" hit 1.500 2.000` + "\n"
+	if r := combined(rec); r != want {
+		t.Errorf("expected\n%s got\n%s", want, r)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	var buf bytes.Buffer
+	l := &T{out: &buf, format: logger.JSONLines}
+	h := l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.RemoteAddr = "5.6.7.8:1"
+		e := Entry(r.Context())
+		e.SetSubConfig("tv")
+		e.SetUser("phone")
+		e.SetCacheHit(false)
+		w.WriteHeader(http.StatusTeapot)
+		_, _ = w.Write([]byte("abc"))
+	}), func(uri string) string {
+		return strings.Replace(uri, "/secret", "", 1)
+	})
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/play/secret/x?token=a", nil))
+	var res map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &res); err != nil {
+		t.Fatal(err, buf.String())
+	}
+	for k, v := range map[string]any{
+		"client": "5.6.7.8", "user": "phone", "uri": "/play/x?token=-", "status": 418.0,
+		"bytes": 3.0, "sub-config": "tv", "cache": "miss",
+	} {
+		if res[k] != v {
+			t.Error("For", k, "expected", v, "got", res[k])
+		}
+	}
+	var none *T
+	if next := http.NewServeMux(); none.Handler(next, nil) != next {
+		t.Error("expected disabled access log to pass handler")
+	}
+}
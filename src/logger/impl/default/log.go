@@ -10,13 +10,14 @@ import (
 	"sync"
 
 	l "ytproxy/logger"
+	rotate "ytproxy/logger/rotate"
 )
 
 type loggerT struct {
 	mu      sync.RWMutex
 	lvl     *l.LevelT
 	lgr     *log.Logger
-	outputs []*os.File
+	outputs []*rotate.T
 }
 
 func (t *loggerT) print(str string, s string, args []any) {
@@ -88,13 +89,10 @@ func New(conf l.ConfigT) (l.T, error) {
 		logger loggerT
 		lgr    = log.Default()
 	)
-	open := func() (*os.File, error) {
-		return os.OpenFile(
-			*conf.FileName,
-			os.O_APPEND|os.O_WRONLY|os.O_CREATE,
-			0664)
+	open := func() (*rotate.T, error) {
+		return conf.Open(*conf.FileName)
 	}
-	logger.outputs = make([]*os.File, 0)
+	logger.outputs = make([]*rotate.T, 0)
 	switch *conf.Output {
 	case l.Stdout:
 		lgr.SetOutput(os.Stdout)
@@ -8,12 +8,13 @@ import (
 	"sync"
 
 	l "ytproxy/logger"
+	rotate "ytproxy/logger/rotate"
 )
 
 type loggerT struct {
 	mu      sync.RWMutex
 	lgr     *slog.Logger
-	outputs []*os.File
+	outputs []*rotate.T
 }
 
 func (t *loggerT) LogError(s string, i ...any) {
@@ -52,11 +53,8 @@ func (t *loggerT) Close() error {
 
 // New creates json formatted logger implementation
 func New(conf l.ConfigT) (l.T, error) {
-	open := func() (*os.File, error) {
-		return os.OpenFile(
-			*conf.FileName,
-			os.O_APPEND|os.O_WRONLY|os.O_CREATE,
-			0664)
+	open := func() (*rotate.T, error) {
+		return conf.Open(*conf.FileName)
 	}
 	var (
 		lvl slog.Level
@@ -72,7 +70,7 @@ func New(conf l.ConfigT) (l.T, error) {
 	case l.Error:
 		lvl = slog.LevelError
 	}
-	mkLogger := func(dst1, dst2 *os.File) {
+	mkLogger := func(dst1 io.Writer, dst2 *rotate.T) {
 		var dst io.Writer
 		if dst2 == nil {
 			dst = dst2
@@ -83,7 +81,7 @@ func New(conf l.ConfigT) (l.T, error) {
 			slog.NewJSONHandler(dst,
 				&slog.HandlerOptions{Level: lvl}))
 	}
-	outputs := make([]*os.File, 0)
+	outputs := make([]*rotate.T, 0)
 	switch *conf.Output {
 	case l.Stdout:
 		mkLogger(os.Stdout, nil)
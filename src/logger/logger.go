@@ -4,6 +4,9 @@ package logger
 import (
 	"encoding/json"
 	"fmt"
+	"time"
+
+	rotate "ytproxy/logger/rotate"
 )
 
 // T is logger interface type
@@ -21,6 +24,31 @@ type ConfigT struct {
 	JSON     *bool    `json:"json"`
 	Output   *OutputT `json:"output"`
 	FileName *string  `json:"filename"`
+	// AccessLog is access log destination: "stdout" or file name,
+	// empty disables access log
+	AccessLog    *string        `json:"access-log"`
+	AccessFormat *AccessFormatT `json:"access-format"`
+	// RotateSize is log files size limit in MiB, 0 disables size rotation
+	RotateSize *uint64 `json:"rotate-size"`
+	// RotateInterval is log files rotation period, "0s" disables time rotation
+	RotateInterval *string `json:"rotate-interval"`
+	// RotateKeep is rotated files count to keep, 0 keeps all
+	RotateKeep *uint64 `json:"rotate-keep"`
+	RotateGzip *bool   `json:"rotate-gzip"`
+}
+
+// Open opens log file with configured rotation
+func (c ConfigT) Open(name string) (*rotate.T, error) {
+	interval, err := time.ParseDuration(*c.RotateInterval)
+	if err != nil {
+		return nil, fmt.Errorf("rotate-interval: %s", err)
+	}
+	return rotate.Open(name, rotate.ConfigT{
+		MaxSize:  *c.RotateSize,
+		Interval: interval,
+		MaxFiles: *c.RotateKeep,
+		Gzip:     *c.RotateGzip,
+	})
 }
 
 // LevelT is logger level
@@ -88,3 +116,30 @@ func (o *OutputT) UnmarshalJSON(b []byte) error {
 	}
 	return nil
 }
+
+// AccessFormatT is access log format
+type AccessFormatT uint8
+
+// access log formats
+const (
+	Combined AccessFormatT = iota
+	JSONLines
+)
+
+// UnmarshalJSON do not use directly
+func (f *AccessFormatT) UnmarshalJSON(b []byte) error {
+	var s string
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return err
+	}
+	switch s {
+	case "combined":
+		*f = Combined
+	case "json":
+		*f = JSONLines
+	default:
+		return fmt.Errorf("cannot unmarshal %s as access log format", b)
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+// Package rotate implements log file with size or time based rotation
+package rotate
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	mib        = 1 << 20
+	timeFormat = "20060102-150405.000"
+	gzSuffix   = ".gz"
+)
+
+// ConfigT is rotation config, zero values disable rotation
+type ConfigT struct {
+	// MaxSize is file size in MiB
+	MaxSize uint64
+	// Interval is rotation period, aligned to UTC
+	Interval time.Duration
+	// MaxFiles is rotated files count to keep, 0 keeps all
+	MaxFiles uint64
+	// Gzip compresses rotated files
+	Gzip bool
+}
+
+// T is log file, safe for concurrent use
+type T struct {
+	mu   sync.Mutex
+	name string
+	conf ConfigT
+	file *os.File
+	size int64
+	next time.Time
+	now  func() time.Time
+	// jobs serializes rotated files compression and pruning,
+	// done outside of writes
+	jobs    sync.Mutex
+	pending sync.WaitGroup
+}
+
+// open files, reopened by Reopen
+var (
+	filesMu sync.Mutex
+	files   = make(map[*T]bool)
+)
+
+// Open opens or creates file for appending
+func Open(name string, conf ConfigT) (*T, error) {
+	t := &T{name: name, conf: conf, now: time.Now}
+	if err := t.open(); err != nil {
+		return nil, err
+	}
+	filesMu.Lock()
+	files[t] = true
+	filesMu.Unlock()
+	return t, nil
+}
+
+func (t *T) open() error {
+	f, err := os.OpenFile(t.name, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0664)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	t.file, t.size = f, info.Size()
+	if t.conf.Interval > 0 {
+		t.next = t.now().Truncate(t.conf.Interval).Add(t.conf.Interval)
+	}
+	return nil
+}
+
+// Write writes to file, rotating it before if needed.
+// Writes to nil file fail like nil *os.File ones
+func (t *T) Write(b []byte) (int, error) {
+	if t == nil {
+		return 0, os.ErrInvalid
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.file == nil {
+		return 0, os.ErrClosed
+	}
+	if t.due(len(b)) {
+		if err := t.rotate(); err != nil {
+			// keep logging into current file
+			_, _ = fmt.Fprintf(os.Stderr, "log rotation: %s\n", err)
+			if t.file == nil {
+				return 0, err
+			}
+		}
+	}
+	n, err := t.file.Write(b)
+	t.size += int64(n)
+	return n, err
+}
+
+func (t *T) due(n int) bool {
+	if t.size == 0 {
+		return false
+	}
+	if t.conf.MaxSize > 0 && t.size+int64(n) > int64(t.conf.MaxSize*mib) {
+		return true
+	}
+	return t.conf.Interval > 0 && !t.now().Before(t.next)
+}
+
+// rotate renames current file, opens new one and removes old files
+func (t *T) rotate() error {
+	if err := t.file.Close(); err != nil {
+		return err
+	}
+	t.file = nil
+	rotated := fmt.Sprintf("%s.%s", t.name, t.now().Format(timeFormat))
+	renameErr := os.Rename(t.name, rotated)
+	if err := t.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+	// compression is slow, writes must not wait for it
+	t.pending.Add(1)
+	go func() {
+		defer t.pending.Done()
+		t.jobs.Lock()
+		defer t.jobs.Unlock()
+		var errs []error
+		if t.conf.Gzip {
+			errs = append(errs, compress(rotated))
+		}
+		errs = append(errs, t.prune())
+		if err := errors.Join(errs...); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "log rotation: %s\n", err)
+		}
+	}()
+	return nil
+}
+
+// prune removes oldest rotated files over MaxFiles
+func (t *T) prune() error {
+	if t.conf.MaxFiles == 0 {
+		return nil
+	}
+	list, err := filepath.Glob(escapeGlob(t.name) + ".*")
+	if err != nil {
+		return err
+	}
+	// file and its gzipped copy have the same stamp while compressed
+	rotated := make(map[string][]string)
+	prefix := t.name + "."
+	for _, v := range list {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(v, prefix), gzSuffix)
+		if _, err := time.Parse(timeFormat, stamp); err == nil {
+			rotated[stamp] = append(rotated[stamp], v)
+		}
+	}
+	stamps := make([]string, 0, len(rotated))
+	for k := range rotated {
+		stamps = append(stamps, k)
+	}
+	// time stamps sort in creation order
+	sort.Strings(stamps)
+	var errs []error
+	for ; len(stamps) > int(t.conf.MaxFiles); stamps = stamps[1:] {
+		for _, v := range rotated[stamps[0]] {
+			if err := os.Remove(v); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func escapeGlob(s string) string {
+	return strings.NewReplacer(`*`, `\*`, `?`, `\?`, `[`, `\[`).Replace(s)
+}
+
+// compress replaces file with gzipped one
+func compress(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(name+gzSuffix, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0664)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(name + gzSuffix)
+		return err
+	}
+	return os.Remove(name)
+}
+
+// reopen closes and opens file again, for external rotation
+func (t *T) reopen() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.file == nil {
+		return nil
+	}
+	if err := t.file.Close(); err != nil {
+		return err
+	}
+	t.file = nil
+	return t.open()
+}
+
+// Close closes file and waits for rotated files compression
+func (t *T) Close() error {
+	filesMu.Lock()
+	delete(files, t)
+	filesMu.Unlock()
+	t.mu.Lock()
+	var err error
+	if t.file != nil {
+		err = t.file.Close()
+		t.file = nil
+	}
+	t.mu.Unlock()
+	t.pending.Wait()
+	return err
+}
+
+// Reopen reopens all open files, so external logrotate
+// can move them away
+func Reopen() error {
+	filesMu.Lock()
+	list := make([]*T, 0, len(files))
+	for k := range files {
+		list = append(list, k)
+	}
+	filesMu.Unlock()
+	var errs []error
+	for _, v := range list {
+		if err := v.reopen(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", v.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
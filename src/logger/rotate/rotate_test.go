@@ -0,0 +1,104 @@
+package rotate
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func rotated(t *testing.T, name string) []string {
+	list, err := filepath.Glob(name + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+func TestSizeRotation(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "log.txt")
+	f, err := Open(name, ConfigT{MaxSize: 1, MaxFiles: 2, Gzip: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	f.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	line := []byte(strings.Repeat("a", mib/2) + "\n")
+	for i := 0; i < 8; i++ {
+		if _, err := f.Write(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// wait for compression
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	list := rotated(t, name)
+	if len(list) != 2 {
+		t.Fatal("expected 2 rotated files, got", list)
+	}
+	for _, v := range list {
+		if !strings.HasSuffix(v, gzSuffix) {
+			t.Error("expected gzipped file, got", v)
+			continue
+		}
+		gz, err := os.Open(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := gzip.NewReader(gz); err != nil {
+			t.Error(v, err)
+		}
+		_ = gz.Close()
+	}
+	if info, err := os.Stat(name); err != nil || info.Size() != int64(len(line)) {
+		t.Error("expected current file with last line, got", info, err)
+	}
+}
+
+func TestIntervalRotation(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "log.txt")
+	now := time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC)
+	f := &T{name: name, conf: ConfigT{Interval: 24 * time.Hour}, now: func() time.Time { return now }}
+	if err := f.open(); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, v := range []time.Duration{0, 30 * time.Minute, time.Hour, time.Hour} {
+		now = now.Add(v)
+		if _, err := f.Write([]byte("x\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if list := rotated(t, name); len(list) != 1 ||
+		!strings.HasSuffix(list[0], ".20240102-003000.000") {
+		t.Error("expected one rotation after midnight, got", list)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "log.txt")
+	f, err := Open(name, ConfigT{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := os.Rename(name, name+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("x\n")); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(name); err != nil || string(b) != "x\n" {
+		t.Error("expected write to reopened file, got", string(b), err)
+	}
+}
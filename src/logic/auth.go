@@ -0,0 +1,68 @@
+package logic
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+
+	auth "ytproxy/auth"
+	cidr "ytproxy/cidr"
+)
+
+const tokenOption = "token"
+
+// authorize checks request token given as "/<route>/<token>/" path segment,
+// option or Bearer header. Path segment is removed from request and kept
+// as Bearer header, so generated links carry token as option.
+// Any request is authorized if no tokens configured,
+// valid signed link is authorized without token
+func (t *AppLogic) authorize(r *http.Request, option string) (auth.TokenT, bool) {
+	if !t.tokens.Enabled() {
+		return auth.TokenT{}, true
+	}
+	if token, uri, ok := t.tokens.PathToken(r.RequestURI); ok {
+		r.RequestURI = uri
+		auth.SetBearer(r, token)
+	}
+	token := option
+	if token == "" {
+		token = auth.Bearer(r)
+	}
+	if res, ok := t.tokens.Lookup(token); ok {
+		return res, true
+	}
+	if signed, err := t.verify(r); signed && err == nil {
+		return auth.TokenT{Label: signedLabel}, true
+	}
+	return auth.TokenT{}, false
+}
+
+// admin checks admin token given as token option or Bearer header,
+// admin routes are disabled if it is not configured
+func (t *AppLogic) admin(r *http.Request) bool {
+	token := r.URL.Query().Get(tokenOption)
+	if token == "" {
+		token = auth.Bearer(r)
+	}
+	return t.adminToken != "" &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(t.adminToken)) == 1
+}
+
+// requestToken returns token option or Bearer header of request
+func requestToken(r *http.Request) string {
+	if token := requestOption(r, tokenOption); token != "" {
+		return token
+	}
+	return auth.Bearer(r)
+}
+
+// allowed checks if client and token may use mini app
+func (t *app) allowed(r *http.Request, token auth.TokenT) error {
+	if !token.Allows(t.name) {
+		return fmt.Errorf("sub-config %s is not allowed for token %s", t.name, token.Label)
+	}
+	if !t.access.Allowed(cidr.IP(r.RemoteAddr)) {
+		return fmt.Errorf("sub-config %s is not allowed for address %s", t.name, r.RemoteAddr)
+	}
+	return nil
+}
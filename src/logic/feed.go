@@ -0,0 +1,156 @@
+package logic
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	extractor "ytproxy/extractor"
+	logger "ytproxy/logger"
+	logger_mux "ytproxy/logger/mux"
+)
+
+const (
+	defaultFeedFormat = "m4a"
+	rssContentType    = "application/rss+xml; charset=utf-8"
+	itunesNamespace   = "http://www.itunes.com/dtds/podcast-1.0.dtd"
+)
+
+type rssT struct {
+	XMLName xml.Name    `xml:"rss"`
+	Version string      `xml:"version,attr"`
+	ITunes  string      `xml:"xmlns:itunes,attr"`
+	Channel rssChannelT `xml:"channel"`
+}
+
+type rssChannelT struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	Description string        `xml:"description"`
+	Author      string        `xml:"itunes:author,omitempty"`
+	Image       *rssImageT    `xml:"image,omitempty"`
+	ITunesImage *itunesImageT `xml:"itunes:image,omitempty"`
+	Items       []rssItemT    `xml:"item"`
+}
+
+type rssImageT struct {
+	URL   string `xml:"url"`
+	Title string `xml:"title"`
+	Link  string `xml:"link"`
+}
+
+type itunesImageT struct {
+	Href string `xml:"href,attr"`
+}
+
+type rssItemT struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	Description string        `xml:"description,omitempty"`
+	GUID        rssGUIDT      `xml:"guid"`
+	PubDate     string        `xml:"pubDate,omitempty"`
+	Enclosure   rssEnclosureT `xml:"enclosure"`
+	Duration    string        `xml:"itunes:duration,omitempty"`
+	ITunesImage *itunesImageT `xml:"itunes:image,omitempty"`
+}
+
+type rssGUIDT struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosureT struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// Feed serves channel or playlist link as RSS 2.0 podcast feed,
+// enclosures are /play/ links with m4a format unless vf option set
+func (t *AppLogic) Feed(w http.ResponseWriter, r *http.Request, log logger.T) {
+	log = logger_mux.NewLayer(log, fmt.Sprintf("App %s", r.RemoteAddr))
+	log.LogInfo("Feed request", "url", r.RequestURI)
+	miniApp, req, miniAppLog, ok := t.request(w, r, log)
+	if !ok {
+		return
+	}
+	info, err := miniApp.playlist(req, time.Now(), miniAppLog)
+	if err != nil {
+		extractError(w, err, miniAppLog)
+		return
+	}
+	options, err := url.ParseQuery(queryOptions(r.RequestURI))
+	if err != nil {
+		options = make(url.Values)
+	}
+	if options.Get("vf") == "" {
+		options.Set("vf", defaultFeedFormat)
+	}
+	feed := makeFeed(info, options.Get("vf"), func(link string) string {
+		return t.playLink(r, link, options.Encode())
+	})
+	b, err := xml.MarshalIndent(feed, "", " ")
+	if err != nil {
+		miniAppLog.LogError("Feed xml", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", rssContentType)
+	if _, err := w.Write(append([]byte(xml.Header), b...)); err != nil {
+		miniAppLog.LogError("Feed write", "error", err)
+	}
+}
+
+func makeFeed(info extractor.InfoT, format string, link func(string) string) rssT {
+	mime := "audio/mp4"
+	if format == "mp4" {
+		mime = "video/mp4"
+	}
+	image := func(u string) *itunesImageT {
+		if u == "" {
+			return nil
+		}
+		return &itunesImageT{Href: u}
+	}
+	ch := rssChannelT{
+		Title:       info.Title,
+		Link:        info.URL,
+		Description: info.Description,
+		Author:      info.Uploader,
+		ITunesImage: image(info.Thumbnail),
+		Items:       make([]rssItemT, 0, len(info.Entries)),
+	}
+	if ch.Description == "" {
+		ch.Description = info.Title
+	}
+	if info.Thumbnail != "" {
+		ch.Image = &rssImageT{URL: info.Thumbnail, Title: info.Title, Link: info.URL}
+	}
+	for _, v := range info.Entries {
+		if v.URL == "" {
+			continue
+		}
+		item := rssItemT{
+			Title:       v.Title,
+			Link:        v.URL,
+			Description: v.Description,
+			GUID:        rssGUIDT{Value: v.URL},
+			Enclosure: rssEnclosureT{
+				URL:    link(removeHTTP(v.URL)),
+				Length: v.FileSize,
+				Type:   mime,
+			},
+			ITunesImage: image(v.Thumbnail),
+		}
+		if !v.Published.IsZero() {
+			item.PubDate = v.Published.Format(time.RFC1123Z)
+		}
+		if v.Duration > 0 {
+			item.Duration = fmt.Sprintf("%d", int64(v.Duration))
+		}
+		ch.Items = append(ch.Items, item)
+	}
+	return rssT{Version: "2.0", ITunes: itunesNamespace, Channel: ch}
+}
@@ -0,0 +1,172 @@
+package logic
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	extractor "ytproxy/extractor"
+	logger "ytproxy/logger"
+	logger_mux "ytproxy/logger/mux"
+	mp4 "ytproxy/mp4"
+)
+
+const (
+	hlsHeadSize    = 64 << 10
+	hlsContentType = "application/vnd.apple.mpegurl"
+	segmentOption  = "seg"
+)
+
+// segmentKey authenticates segment links of served playlists,
+// so they live as long as process does
+var segmentKey = func() []byte {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}()
+
+// HLS serves VOD playlist made of resolved fragmented mp4 link segments.
+// Segments point to /play/ link, so they are served with upstream Range requests.
+// Playlist takes client play token, its segments take stream slots only.
+func (t *AppLogic) HLS(w http.ResponseWriter, r *http.Request, log logger.T) {
+	log = logger_mux.NewLayer(log, fmt.Sprintf("App %s", r.RemoteAddr))
+	log.LogInfo("HLS request", "url", r.RequestURI)
+	miniApp, req, miniAppLog, ok := t.request(w, r, log)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	if err := t.limits.Play(clientKey(r), now); err != nil {
+		extractError(w, err, miniAppLog)
+		return
+	}
+	res, _, err := miniApp.resolve(req, now, miniAppLog)
+	if err != nil {
+		extractError(w, err, miniAppLog)
+		return
+	}
+	idx, err := miniApp.index(r, res, miniAppLog)
+	if errors.Is(err, mp4.ErrNotFragmented) {
+		miniAppLog.LogWarning("HLS", "error", err)
+		http.Error(w, "mp4 is not fragmented, use /play/ link",
+			http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		miniAppLog.LogError("HLS index", "error", err)
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+	miniAppLog.LogDebug("HLS index", "segments", len(idx.Segments))
+	w.Header().Set("Content-Type", hlsContentType)
+	media := t.playLink(r, req.URL, fmt.Sprintf("%s&%s=%s", requestOptions(req),
+		segmentOption, segmentMAC(req.URL)))
+	if _, err := io.WriteString(w, makeHLSPlaylist(idx, media)); err != nil {
+		miniAppLog.LogError("HLS playlist write", "error", err)
+	}
+}
+
+// segmentMAC marks link as segment of served playlist
+func segmentMAC(link string) string {
+	h := hmac.New(sha256.New, segmentKey)
+	h.Write([]byte(link))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// isSegment tells if request is segment fetch of served playlist for link
+func isSegment(r *http.Request, link string) bool {
+	seg := requestOption(r, segmentOption)
+	return seg != "" && hmac.Equal([]byte(seg), []byte(segmentMAC(link)))
+}
+
+// index reads mp4 boxes with upstream Range requests
+func (t *app) index(r *http.Request, res extractor.ResultT,
+	log logger.T) (mp4.IndexT, error) {
+	read := func(offset, size int64) ([]byte, []string, error) {
+		rng := fmt.Sprintf("bytes=%d-%d", offset, offset+size-1)
+		log.LogDebug("HLS index read", "range", rng)
+		resp, err := t.streamer.Fetch(r, res.URL, rng)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer func() {
+			if err := resp.Body.Close(); err != nil {
+				log.LogError("body close", "error", err)
+			}
+		}()
+		if resp.StatusCode != http.StatusPartialContent {
+			return nil, nil, fmt.Errorf("range request failed: %s", resp.Status)
+		}
+		b, err := io.ReadAll(io.LimitReader(resp.Body, size))
+		return b, resp.Header.Values("Content-Range"), err
+	}
+	head, contentRange, err := read(0, hlsHeadSize)
+	if err != nil {
+		return mp4.IndexT{}, err
+	}
+	total, err := parseContentRangeTotal(contentRange)
+	if err != nil {
+		return mp4.IndexT{}, err
+	}
+	return mp4.Index(func(offset, size int64) ([]byte, error) {
+		if offset+size <= int64(len(head)) {
+			return head[offset : offset+size], nil
+		}
+		b, _, err := read(offset, size)
+		return b, err
+	}, total)
+}
+
+// parseContentRangeTotal gets full size from "bytes 0-100/12345"
+func parseContentRangeTotal(h []string) (int64, error) {
+	if len(h) == 0 {
+		return 0, fmt.Errorf("no Content-Range header")
+	}
+	i := strings.LastIndexByte(h[0], '/')
+	if i < 0 {
+		return 0, fmt.Errorf("bad Content-Range header %q", h[0])
+	}
+	total, err := strconv.ParseInt(h[0][i+1:], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad Content-Range header %q", h[0])
+	}
+	return total, nil
+}
+
+func makeHLSPlaylist(idx mp4.IndexT, media string) string {
+	var (
+		b      strings.Builder
+		target float64
+	)
+	for _, v := range idx.Segments {
+		target = math.Max(target, v.Duration)
+	}
+	byteRange := func(r mp4.RangeT) string {
+		return fmt.Sprintf("%d@%d", r.Length, r.Offset)
+	}
+	fmt.Fprintln(&b, "#EXTM3U")
+	fmt.Fprintln(&b, "#EXT-X-VERSION:7")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", int(math.Ceil(target)))
+	fmt.Fprintln(&b, "#EXT-X-MEDIA-SEQUENCE:0")
+	fmt.Fprintln(&b, "#EXT-X-PLAYLIST-TYPE:VOD")
+	fmt.Fprintln(&b, "#EXT-X-INDEPENDENT-SEGMENTS")
+	fmt.Fprintf(&b, "#EXT-X-MAP:URI=\"%s\",BYTERANGE=\"%s\"\n", media, byteRange(idx.Init))
+	for _, v := range idx.Segments {
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n", v.Duration)
+		fmt.Fprintf(&b, "#EXT-X-BYTERANGE:%s\n", byteRange(v.RangeT))
+		fmt.Fprintln(&b, media)
+	}
+	fmt.Fprintln(&b, "#EXT-X-ENDLIST")
+	return b.String()
+}
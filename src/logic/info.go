@@ -0,0 +1,124 @@
+package logic
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	extractor "ytproxy/extractor"
+	logger "ytproxy/logger"
+	logger_mux "ytproxy/logger/mux"
+)
+
+const noCodec = "none"
+
+type infoT struct {
+	ID        string            `json:"id"`
+	Title     string            `json:"title"`
+	Uploader  string            `json:"uploader"`
+	URL       string            `json:"url"`
+	Duration  float64           `json:"duration"`
+	IsLive    bool              `json:"is_live"`
+	Thumbnail string            `json:"thumbnail"`
+	Heights   []uint64          `json:"heights"`
+	Formats   []string          `json:"formats"`
+	Play      map[string]string `json:"play"`
+	App       string            `json:"app"`
+}
+
+// Info serves normalized video metadata and /play/ links as JSON
+func (t *AppLogic) Info(w http.ResponseWriter, r *http.Request, log logger.T) {
+	log = logger_mux.NewLayer(log, fmt.Sprintf("App %s", r.RemoteAddr))
+	log.LogInfo("Info request", "url", r.RequestURI)
+	miniApp, req, miniAppLog, ok := t.request(w, r, log)
+	if !ok {
+		return
+	}
+	info, err := miniApp.info(req, time.Now(), miniAppLog)
+	if err != nil {
+		extractError(w, err, miniAppLog)
+		return
+	}
+	res := miniApp.makeInfo(info, func(height uint64, format string) string {
+		return t.playLink(r, req.URL, requestOptions(
+			miniApp.fixRequest(req.URL, height, format)))
+	})
+	b, err := json.Marshal(res)
+	if err != nil {
+		miniAppLog.LogError("Info json", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(b); err != nil {
+		miniAppLog.LogError("Info write", "error", err)
+	}
+}
+
+// info returns cached or freshly extracted video metadata
+func (t *app) info(
+	req extractor.RequestT,
+	now time.Time,
+	log logger.T,
+) (extractor.InfoT, error) {
+	return t.meta(t.infoCache, req.URL, now, log,
+		func() (extractor.InfoT, error) {
+			return t.extractor.Info(req, log)
+		})
+}
+
+// makeInfo lists heights and formats, link makes play link for them.
+// Play links are keyed by "<format>" and "<format>-<height>".
+func (t *app) makeInfo(info extractor.InfoT,
+	link func(uint64, string) string) infoT {
+	res := infoT{
+		ID:        info.ID,
+		Title:     info.Title,
+		Uploader:  info.Uploader,
+		URL:       info.URL,
+		Duration:  info.Duration,
+		IsLive:    info.IsLive,
+		Thumbnail: info.Thumbnail,
+		Heights:   make([]uint64, 0),
+		Formats:   make([]string, 0),
+		Play:      make(map[string]string),
+		App:       t.name,
+	}
+	heights := make(map[uint64]bool)
+	formats := make(map[string]bool)
+	for _, v := range info.Formats {
+		video, audio := v.VCodec != noCodec, v.ACodec != noCodec
+		if video && v.Height > 0 {
+			heights[v.Height] = true
+		}
+		switch {
+		case v.Ext == "mp4" && video:
+			formats["mp4"] = true
+		case v.Ext == "m4a" && audio:
+			formats["m4a"] = true
+		}
+	}
+	for k := range heights {
+		res.Heights = append(res.Heights, k)
+	}
+	sort.Slice(res.Heights, func(i, j int) bool { return res.Heights[i] < res.Heights[j] })
+	for _, f := range []string{"mp4", "m4a"} {
+		if !formats[f] {
+			continue
+		}
+		res.Formats = append(res.Formats, f)
+		res.Play[f] = link(0, f)
+		if f != "mp4" {
+			continue
+		}
+		for _, h := range res.Heights {
+			if h <= t.maxVideoHeight {
+				res.Play[f+"-"+strconv.FormatUint(h, 10)] = link(h, f)
+			}
+		}
+	}
+	return res
+}
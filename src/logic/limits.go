@@ -0,0 +1,136 @@
+package logic
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	cidr "ytproxy/cidr"
+	extractor "ytproxy/extractor"
+	limiter "ytproxy/limiter"
+	logger "ytproxy/logger"
+	accesslog "ytproxy/logger/access"
+)
+
+// requestExtractor takes client extract token before every invocation
+// and adds invocation time to access log entry, cached results do not reach it
+type requestExtractor struct {
+	extractor.T
+	limits *limiter.T
+	client string
+	entry  *accesslog.EntryT
+}
+
+func (t requestExtractor) Extract(req extractor.RequestT, log logger.T) (extractor.ResultT, error) {
+	start := time.Now()
+	if err := t.limits.Extract(t.client, start); err != nil {
+		return extractor.ResultT{}, err
+	}
+	defer func() {
+		t.entry.AddExtractTime(time.Since(start))
+	}()
+	return t.T.Extract(req, log)
+}
+
+func (t requestExtractor) Playlist(req extractor.RequestT, log logger.T) (extractor.InfoT, error) {
+	start := time.Now()
+	if err := t.limits.Extract(t.client, start); err != nil {
+		return extractor.InfoT{}, err
+	}
+	defer func() {
+		t.entry.AddExtractTime(time.Since(start))
+	}()
+	return t.T.Playlist(req, log)
+}
+
+func (t requestExtractor) Search(req extractor.SearchT, log logger.T) (extractor.InfoT, error) {
+	start := time.Now()
+	if err := t.limits.Extract(t.client, start); err != nil {
+		return extractor.InfoT{}, err
+	}
+	defer func() {
+		t.entry.AddExtractTime(time.Since(start))
+	}()
+	return t.T.Search(req, log)
+}
+
+func (t requestExtractor) Info(req extractor.RequestT, log logger.T) (extractor.InfoT, error) {
+	start := time.Now()
+	if err := t.limits.Extract(t.client, start); err != nil {
+		return extractor.InfoT{}, err
+	}
+	defer func() {
+		t.entry.AddExtractTime(time.Since(start))
+	}()
+	return t.T.Info(req, log)
+}
+
+// clientKey returns client address limits are counted by
+func clientKey(r *http.Request) string {
+	if ip := cidr.IP(r.RemoteAddr); ip != nil {
+		return ip.String()
+	}
+	return r.RemoteAddr
+}
+
+// withRequest returns mini app copy with extractor limited for client of r
+// and timed for access log
+func (t *AppLogic) withRequest(a app, r *http.Request) app {
+	entry := accesslog.Entry(r.Context())
+	if t.limits != nil || entry != nil {
+		a.extractor = requestExtractor{T: a.extractor, limits: t.limits,
+			client: clientKey(r), entry: entry}
+	}
+	return a
+}
+
+// limitPlay takes client play token and stream slot,
+// release must be called when stream ends.
+// Segments of served HLS playlist take stream slot only,
+// playlist request took play token already
+func (t *AppLogic) limitPlay(r *http.Request, segment bool, now time.Time,
+	log logger.T) (func(), error) {
+	client := clientKey(r)
+	if !segment {
+		if err := t.limits.Play(client, now); err != nil {
+			return nil, err
+		}
+	}
+	release, err := t.limits.Stream(client)
+	if err != nil {
+		return nil, err
+	}
+	log.LogDebug("Limits", "state", t.limits.State(client, now))
+	return release, nil
+}
+
+// limitedPlay answers limited play request with error media if configured,
+// dumb players do not understand 429
+func (t *AppLogic) limitedPlay(
+	w http.ResponseWriter,
+	r *http.Request,
+	miniApp app,
+	req extractor.RequestT,
+	err error,
+	log logger.T,
+) {
+	if t.limits.ErrorMedia() {
+		log.LogWarning("Limited", "error", err)
+		miniApp.playError(w, r, req, err, log)
+		return
+	}
+	extractError(w, err, log)
+}
+
+// extractError answers 429 with Retry-After for limited requests
+// and 502 for other extractor errors
+func extractError(w http.ResponseWriter, err error, log logger.T) {
+	var limitErr *limiter.LimitError
+	if errors.As(err, &limitErr) {
+		log.LogWarning("Limited", "error", err)
+		w.Header().Set("Retry-After", limitErr.RetryAfterSeconds())
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+}
@@ -2,39 +2,86 @@
 package logic
 
 import (
+	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
-	"slices"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
+	auth "ytproxy/auth"
 	cache "ytproxy/cache"
+	cidr "ytproxy/cidr"
+	device "ytproxy/device"
 	extractor "ytproxy/extractor"
+	limiter "ytproxy/limiter"
 	logger "ytproxy/logger"
+	accesslog "ytproxy/logger/access"
 	logger_mux "ytproxy/logger/mux"
+	rewrite "ytproxy/rewrite"
+	sessions "ytproxy/sessions"
+	sign "ytproxy/sign"
+	sites "ytproxy/sites"
 	streamer "ytproxy/streamer"
 )
 
 const (
 	defaultVideoFormat = "mp4"
+	linkOption         = "u"
+	profileOption      = "profile"
 )
 
 type app struct {
 	cache              cache.T
+	playlistCache      cache.MetaT
+	infoCache          cache.MetaT
+	thumbnailCache     cache.FileT
 	extractor          extractor.T
 	streamer           streamer.T
 	name               string
 	sites              []string
 	defaultVideoHeight uint64
 	maxVideoHeight     uint64
+	selectable         bool
+	siteIndex          sites.IndexT
+	defaultFormat      string
+	access             cidr.AccessT
 }
 
 // AppLogic is logic instance
 type AppLogic struct {
 	defaultApp app
 	appList    []app
+	rewrite    rewrite.T
+	devices    device.ListT
+	tokens     auth.ListT
+	index      sites.IndexT
+	limits     *limiter.T
+	signer     *sign.T
+	adminToken string
+	sessions   *sessions.T
+}
+
+// Global is options shared by all mini apps
+type Global struct {
+	// Rewrite normalizes links before mini app selection
+	Rewrite rewrite.T
+	// Devices override mini app and its defaults by client
+	Devices device.ListT
+	// Tokens are API tokens, if not empty every request must have one
+	Tokens auth.ListT
+	// Limits are per client rate limits and streams caps, nil disables them
+	Limits *limiter.T
+	// Signer verifies signed links, nil if signing keys are not set
+	Signer *sign.T
+	// AdminToken authorizes admin routes, empty disables them
+	AdminToken string
+	// Sessions tracks /play/ requests, nil disables tracking
+	Sessions *sessions.T
 }
 
 // Option is mini app, that serving selected sites
@@ -44,21 +91,68 @@ type Option struct {
 	X                  extractor.T
 	S                  streamer.T
 	C                  cache.T
+	PC                 cache.MetaT
+	IC                 cache.MetaT
+	TC                 cache.FileT
 	DefaultVideoHeight uint64
 	MaxVideoHeight     uint64
+	// Selectable allows to select mini app by profile option,
+	// for Sites only if not empty
+	Selectable bool
+	Access     cidr.AccessT
 }
 
 // New creates app logic instance
-func New(def Option, opts []Option) *AppLogic {
+func New(def Option, opts []Option, g Global) (*AppLogic, error) {
 	var t AppLogic
 	t.set(def, opts)
-	return &t
+	t.rewrite = g.Rewrite
+	t.devices = g.Devices
+	t.tokens = g.Tokens
+	t.limits = g.Limits
+	t.signer = g.Signer
+	t.adminToken = g.AdminToken
+	t.sessions = g.Sessions
+	lists := make([][]string, 0, len(opts)+1)
+	for _, v := range opts {
+		lists = append(lists, v.Sites)
+	}
+	var err error
+	t.index, err = sites.New(append(lists, def.Sites))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range t.appList {
+		if t.appList[k].siteIndex, err = sites.New([][]string{v.sites}); err != nil {
+			return nil, err
+		}
+	}
+	for _, v := range t.devices.Profiles() {
+		if v.SubConfig != "" && !t.hasApp(v.SubConfig) {
+			return nil, fmt.Errorf("device profile %s: sub-config %s not found",
+				v.Name, v.SubConfig)
+		}
+	}
+	return &t, nil
+}
+
+// hasApp checks if sub-config name exists
+func (t *AppLogic) hasApp(name string) bool {
+	for _, v := range t.appList {
+		if v.name == name {
+			return true
+		}
+	}
+	return false
 }
 
 func (t *AppLogic) set(def Option, opts []Option) {
 	t.defaultApp = app{
 		name:               "default",
 		cache:              def.C,
+		playlistCache:      def.PC,
+		infoCache:          def.IC,
+		thumbnailCache:     def.TC,
 		extractor:          def.X,
 		streamer:           def.S,
 		defaultVideoHeight: def.DefaultVideoHeight,
@@ -70,29 +164,64 @@ func (t *AppLogic) set(def Option, opts []Option) {
 	for _, v := range opts {
 		t.appList = append(t.appList, app{
 			cache:              v.C,
+			playlistCache:      v.PC,
+			infoCache:          v.IC,
+			thumbnailCache:     v.TC,
 			extractor:          v.X,
 			streamer:           v.S,
 			name:               v.Name,
 			sites:              v.Sites,
 			defaultVideoHeight: v.DefaultVideoHeight,
 			maxVideoHeight:     v.MaxVideoHeight,
+			selectable:         v.Selectable,
+			access:             v.Access,
 		})
 	}
 }
 
-func (t *AppLogic) selectApp(rawURL string) (app, error) {
-	host, err := parseURLHost(rawURL)
-	if err == nil {
-		for _, v := range t.appList {
-			if slices.Contains(v.sites, host) {
-				return v, nil
-			}
+// selectApp returns mini app and its site entry matched by link,
+// default app serves links not matched by any entry if its sites list is empty
+func (t *AppLogic) selectApp(rawURL string) (app, string, error) {
+	if k, site, ok := t.index.Match(rawURL); ok {
+		if k < len(t.appList) {
+			return t.appList[k], site, nil
 		}
+		return t.defaultApp, site, nil
+	}
+	if len(t.defaultApp.sites) == 0 {
+		return t.defaultApp, "", nil
 	}
-	if len(t.defaultApp.sites) == 0 || slices.Contains(t.defaultApp.sites, host) {
-		return t.defaultApp, nil
+	host, _ := parseURLHost(rawURL)
+	return app{}, "", fmt.Errorf("host %s did not match any sites in config or sub-configs", host)
+}
+
+// selectProfile returns selectable mini app by name,
+// if it has sites list link must match it
+func (t *AppLogic) selectProfile(name string, rawURL string) (app, string, error) {
+	miniApp, site, err := t.selectByName(name, rawURL)
+	if err == nil && !miniApp.selectable {
+		return app{}, "", fmt.Errorf("profile %s is not selectable", name)
 	}
-	return app{}, fmt.Errorf("host %s did not match any sites in config or sub-configs", host)
+	return miniApp, site, err
+}
+
+// selectByName returns mini app by name,
+// if it has sites list link must match it
+func (t *AppLogic) selectByName(name string, rawURL string) (app, string, error) {
+	for _, v := range t.appList {
+		if v.name != name {
+			continue
+		}
+		if len(v.sites) == 0 {
+			return v, "", nil
+		}
+		if _, site, ok := v.siteIndex.Match(rawURL); ok {
+			return v, site, nil
+		}
+		host, _ := parseURLHost(rawURL)
+		return app{}, "", fmt.Errorf("host %s is not allowed for profile %s", host, name)
+	}
+	return app{}, "", fmt.Errorf("profile %s not found", name)
 }
 
 func parseURLHost(rawURL string) (string, error) {
@@ -103,40 +232,160 @@ func parseURLHost(rawURL string) (string, error) {
 // Run serves single client
 func (t *AppLogic) Run(w http.ResponseWriter, r *http.Request, log logger.T) {
 	log = logger_mux.NewLayer(log, fmt.Sprintf("App %s", r.RemoteAddr))
-	log.LogInfo("Play request", "url", r.RequestURI, "full", r)
+	log.LogInfo("Play request", "url", r.RequestURI)
+	log.LogDebug("Play request", "headers", r.Header)
 	defer log.LogInfo("Player disconnected")
 	now := time.Now()
+	miniApp, req, miniAppLog, ok := t.request(w, r, log)
+	if !ok {
+		return
+	}
+	release, err := t.limitPlay(r, isSegment(r, req.URL), now, miniAppLog)
+	if err != nil {
+		t.limitedPlay(w, r, miniApp, req, err, miniAppLog)
+		return
+	}
+	defer release()
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	r = r.WithContext(ctx)
+	session := t.sessions.Start(sessions.InfoT{
+		Client:    r.RemoteAddr,
+		SubConfig: miniApp.name,
+		URL:       req.URL,
+		Height:    req.HEIGHT,
+		Format:    req.FORMAT,
+		Start:     now,
+	}, cancel)
+	defer session.End()
+	w = session.Writer(w)
+	res, cached, err := miniApp.resolve(req, now, miniAppLog)
+	session.SetCacheHit(cached)
+	accesslog.Entry(r.Context()).SetCacheHit(cached)
+	if errors.As(err, new(*limiter.LimitError)) {
+		t.limitedPlay(w, r, miniApp, req, err, miniAppLog)
+		return
+	}
+	if err != nil {
+		miniApp.playError(w, r, req, err, miniAppLog)
+		return
+	}
+	miniApp.play(w, r, req, res, miniAppLog)
+}
+
+// request authorizes and verifies client request, parses it and selects mini app.
+// Client gets response and false returned if request cannot be served.
+func (t *AppLogic) request(
+	w http.ResponseWriter,
+	r *http.Request,
+	log logger.T,
+) (app, extractor.RequestT, logger.T, bool) {
+	token, ok := t.authorize(r, requestOption(r, tokenOption))
+	if !ok {
+		log.LogWarning("", "error", "missing or invalid token")
+		w.WriteHeader(http.StatusUnauthorized)
+		return app{}, extractor.RequestT{}, log, false
+	}
+	if token.Label != "" {
+		log = logger_mux.NewLayer(log, fmt.Sprintf("Token %s", token.Label))
+	}
+	// path token is removed by authorize, so it is not a part of signed link
+	if _, err := t.verify(r); err != nil {
+		log.LogWarning("", "error", err)
+		w.WriteHeader(http.StatusForbidden)
+		return app{}, extractor.RequestT{}, log, false
+	}
 	link, height, format := parseQuery(r.RequestURI)
-	miniApp, err := t.selectApp(link)
+	miniApp, req, miniAppLog, err := t.selectRequest(r, token, link, height, format,
+		requestOption(r, profileOption), log)
 	if err != nil {
 		log.LogWarning("", "error", err)
 		w.WriteHeader(http.StatusForbidden)
-		return
+		return app{}, extractor.RequestT{}, log, false
+	}
+	return miniApp, req, miniAppLog, true
+}
+
+// selectRequest normalizes link and selects mini app allowed for client of r
+// and token by profile, device or link
+func (t *AppLogic) selectRequest(
+	r *http.Request,
+	token auth.TokenT,
+	link string,
+	height uint64,
+	format string,
+	profile string,
+	log logger.T,
+) (app, extractor.RequestT, logger.T, error) {
+	link = t.normalize(link, log)
+	var (
+		miniApp app
+		site    string
+		err     error
+	)
+	dev, _ := t.devices.Match(r)
+	switch {
+	case profile != "":
+		miniApp, site, err = t.selectProfile(profile, link)
+	case dev.SubConfig != "":
+		// links outside of device sub-config sites go to their own sub-config
+		if miniApp, site, err = t.selectByName(dev.SubConfig, link); err != nil {
+			log.LogDebug("Device sub-config skipped", "device", dev.Name, "error", err)
+			miniApp, site, err = t.selectApp(link)
+		}
+	default:
+		miniApp, site, err = t.selectApp(link)
+	}
+	if err == nil {
+		err = miniApp.allowed(r, token)
+	}
+	if err != nil {
+		return app{}, extractor.RequestT{}, log, err
 	}
+	miniApp = t.withRequest(miniApp.withDevice(dev), r)
+	entry := accesslog.Entry(r.Context())
+	entry.SetUser(token.Label)
+	entry.SetSubConfig(miniApp.name)
 	miniAppLog := logger_mux.NewLayer(log, fmt.Sprintf("[%s]", miniApp.name))
+	req := miniApp.fixRequest(link, height, format)
+	log.LogInfo("", "req", req, "app", miniApp.name, "site", site, "device", dev.Name)
+	return miniApp, req, miniAppLog, nil
+}
+
+// normalize applies rewrite rules to link
+func (t *AppLogic) normalize(link string, log logger.T) string {
+	res := t.rewrite.Apply(link)
+	if res != link {
+		log.LogDebug("Rewritten", "from", link, "to", res)
+	}
+	return res
+}
+
+// resolve returns cached or freshly extracted link and if it was cached
+func (t *app) resolve(
+	req extractor.RequestT,
+	now time.Time,
+	log logger.T,
+) (extractor.ResultT, bool, error) {
 	printExpired := func(links []extractor.RequestT) {
 		if len(links) > 0 {
-			miniAppLog.LogDebug("Expired", "links", links)
+			log.LogDebug("Expired", "links", links)
 		}
 	}
-	req := miniApp.fixRequest(link, height, format)
-	log.LogInfo("", "req", req, "app", miniApp.name)
-	if res, ok, expired := miniApp.cacheCheck(req, now); ok {
-		printExpired(expired)
-		miniAppLog.LogDebug("Already cached", "link", res)
-		miniApp.play(w, r, req, res, miniAppLog)
-	} else {
-		printExpired(expired)
-		res, err := miniApp.extractor.Extract(req, miniAppLog)
-		if err != nil {
-			miniAppLog.LogError("URL extract", "error", err)
-			miniApp.playError(w, req, err, miniAppLog)
-			return
-		}
-		miniAppLog.LogDebug("Extractor returned", "link", res)
-		miniApp.cacheAdd(req, res, now, miniAppLog)
-		miniApp.play(w, r, req, res, miniAppLog)
+	res, ok, expired := t.cacheCheck(req, now)
+	printExpired(expired)
+	if ok {
+		log.LogDebug("Already cached", "link", res)
+		return res, true, nil
 	}
+	res, err := t.extractor.Extract(req, log)
+	if err != nil {
+		log.LogError("URL extract", "error", err)
+		return res, false, err
+	}
+	log.LogDebug("Extractor returned", "link", res)
+	t.cacheAdd(req, res, now, log)
+	return res, false, nil
 }
 
 func (t *app) play(
@@ -148,17 +397,18 @@ func (t *app) play(
 ) {
 	if err := t.streamer.Play(w, r, res, log); err != nil {
 		log.LogError("Restream", "error", err)
-		t.playError(w, req, err, log)
+		t.playError(w, r, req, err, log)
 	}
 }
 
 func (t *app) playError(
 	w http.ResponseWriter,
+	r *http.Request,
 	req extractor.RequestT,
 	err error,
 	log logger.T,
 ) {
-	if err := t.streamer.PlayError(w, req, err); err != nil {
+	if err := t.streamer.PlayError(w, r, req, err); err != nil {
 		log.LogError("Error occurred while playing error video", "error", err)
 	}
 }
@@ -186,16 +436,16 @@ func removeHTTP(url string) string {
 	return url
 }
 
+// parseQuery splits "/<route>/<link>?/?<options>"
+// or "/<route>?u=<link>&<options>" request,
+// format is empty if not set or not supported
 func parseQuery(query string) (string, uint64, string) {
-	query = strings.TrimSpace(strings.TrimPrefix(query, "/play/"))
-	split := strings.Split(query, "?/?")
-	link := removeHTTP(split[0])
-	format := defaultVideoFormat
-	var height uint64
-	if len(split) != 2 {
-		return link, 0, format
-	}
-	tOpts, tErr := url.ParseQuery(split[1])
+	link, options := splitQuery(query)
+	var (
+		height uint64
+		format string
+	)
+	tOpts, tErr := url.ParseQuery(options)
 	if tErr == nil {
 		if tvh, ok := tOpts["vh"]; ok {
 			height, _ = strconv.ParseUint(tvh[0], 10, 64)
@@ -207,9 +457,122 @@ func parseQuery(query string) (string, uint64, string) {
 		}
 	}
 	return link, height, format
+}
+
+// splitQuery returns link and raw options of request in any format
+func splitQuery(query string) (string, string) {
+	query = strings.TrimSpace(strings.TrimPrefix(query, "/"))
+	i := strings.IndexAny(query, "/?")
+	if i >= 0 && query[i] == '?' {
+		return splitCleanQuery(query[i+1:])
+	}
+	if i >= 0 {
+		query = query[i+1:]
+	}
+	split := strings.Split(query, "?/?")
+	link := removeHTTP(split[0])
+	if len(split) != 2 {
+		return link, ""
+	}
+	return link, split[1]
+}
+
+// splitCleanQuery splits "u=<link>&<options>",
+// link is url-encoded or base64url-encoded
+func splitCleanQuery(query string) (string, string) {
+	opts, err := url.ParseQuery(query)
+	if err != nil {
+		return "", ""
+	}
+	link := decodeLink(opts.Get(linkOption))
+	opts.Del(linkOption)
+	return removeHTTP(link), opts.Encode()
+}
+
+// decodeLink decodes base64url link, plain links are returned as is
+func decodeLink(link string) string {
+	// base64url alphabet has no characters every link has
+	if link == "" || strings.ContainsAny(link, ".:/") {
+		return link
+	}
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(link, "="))
+	if err != nil || !utf8.Valid(b) {
+		return link
+	}
+	return string(b)
+}
+
+// queryOptions returns raw options part of request
+func queryOptions(query string) string {
+	_, options := splitQuery(query)
+	return options
+}
+
+// requestOption returns option of request
+func requestOption(r *http.Request, name string) string {
+	opts, err := url.ParseQuery(queryOptions(r.RequestURI))
+	if err != nil {
+		return ""
+	}
+	return opts.Get(name)
+}
+
+// requestOptions makes options string selecting same height and format
+func requestOptions(req extractor.RequestT) string {
+	return fmt.Sprintf("vh=%s&vf=%s", req.HEIGHT, req.FORMAT)
+}
 
+// playLink makes absolute /play/ link served by this host
+func (t *AppLogic) playLink(r *http.Request, link string, options string) string {
+	return t.routeLink(r, "play", link, options)
 }
 
+// routeLink makes absolute "/<route>?u=<link>&<options>" link served by this host,
+// keeping profile and token of r. Link is signed if signing keys are set,
+// sig and exp options are not forwarded
+func (t *AppLogic) routeLink(r *http.Request, route string, link string, options string) string {
+	res := fmt.Sprintf("http://%s/%s?%s=%s", r.Host, route, linkOption,
+		url.QueryEscape(link))
+	opts, _ := url.ParseQuery(options)
+	token := opts.Get(tokenOption)
+	if token == "" {
+		token = requestToken(r)
+	}
+	for _, v := range []string{sigOption, expOption, tokenOption} {
+		opts.Del(v)
+	}
+	if profile := requestOption(r, profileOption); profile != "" && !opts.Has(profileOption) {
+		opts.Set(profileOption, profile)
+	}
+	if t.signer != nil {
+		sig, exp := t.signer.Sign(route, t.rewrite.Apply(link), opts, t.linkExpire(r, time.Now()))
+		opts.Set(expOption, exp)
+		opts.Set(sigOption, sig)
+	}
+	if token != "" {
+		opts.Set(tokenOption, token)
+	}
+	if len(opts) > 0 {
+		res += "&" + opts.Encode()
+	}
+	return res
+}
+
+// withDevice returns mini app copy with device profile overrides
+func (t app) withDevice(d device.ProfileT) app {
+	if d.DefaultVideoHeight != 0 {
+		t.defaultVideoHeight = d.DefaultVideoHeight
+	}
+	if d.MaxVideoHeight != 0 {
+		t.maxVideoHeight = d.MaxVideoHeight
+	}
+	if d.DefaultFormat != "" {
+		t.defaultFormat = d.DefaultFormat
+	}
+	return t
+}
+
+// fixRequest applies height limits and defaults, empty format is unset
 func (t *app) fixRequest(link string, height uint64, format string) extractor.RequestT {
 	var (
 		h   string
@@ -225,6 +588,12 @@ func (t *app) fixRequest(link string, height uint64, format string) extractor.Re
 	default:
 		h = toS(height)
 	}
+	if format == "" {
+		format = t.defaultFormat
+	}
+	if format == "" {
+		format = defaultVideoFormat
+	}
 	return extractor.RequestT{
 		URL:    link,
 		HEIGHT: h,
@@ -1,20 +1,39 @@
 package logic
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
+	"time"
+
+	auth "ytproxy/auth"
+	device "ytproxy/device"
+	extractor "ytproxy/extractor"
+	limiter "ytproxy/limiter"
+	empty "ytproxy/logger/impl/empty"
+	rewrite "ytproxy/rewrite"
+	sessions "ytproxy/sessions"
+	sign "ytproxy/sign"
 )
 
 func TestParseQuery(t *testing.T) {
 	var testPairs = map[string]string{
-		"/play/youtu.be/jNQXAC9IVRw?/?vh=360&vf=mp4":   "youtu.be/jNQXAC9IVRw|360|mp4",
-		"/play/youtu.be/jNQXAC9IVRw?/?vh=720&vf=avi":   "youtu.be/jNQXAC9IVRw|720|mp4",
-		"/play/youtu.be/jNQXAC9IVRw":                   "youtu.be/jNQXAC9IVRw|0|mp4",
-		"/play/youtu.be/jNQXAC9IVRw?/?":                "youtu.be/jNQXAC9IVRw|0|mp4",
-		"/play/youtu.be/jNQXAC9IVRw?/?vf=avi":          "youtu.be/jNQXAC9IVRw|0|mp4",
-		"/play/youtu.be/jNQXAC9IVRw?/?vf=mp4":          "youtu.be/jNQXAC9IVRw|0|mp4",
-		"/play/youtu.be/jNQXAC9IVRw?/?vf=mp4&vh=11111": "youtu.be/jNQXAC9IVRw|11111|mp4",
+		"/play/youtu.be/jNQXAC9IVRw?/?vh=360&vf=mp4":                                  "youtu.be/jNQXAC9IVRw|360|mp4",
+		"/play/youtu.be/jNQXAC9IVRw?/?vh=720&vf=avi":                                  "youtu.be/jNQXAC9IVRw|720|",
+		"/play/youtu.be/jNQXAC9IVRw":                                                  "youtu.be/jNQXAC9IVRw|0|",
+		"/play/youtu.be/jNQXAC9IVRw?/?":                                               "youtu.be/jNQXAC9IVRw|0|",
+		"/play/youtu.be/jNQXAC9IVRw?/?vf=avi":                                         "youtu.be/jNQXAC9IVRw|0|",
+		"/play/youtu.be/jNQXAC9IVRw?/?vf=mp4":                                         "youtu.be/jNQXAC9IVRw|0|mp4",
+		"/play/youtu.be/jNQXAC9IVRw?/?vf=mp4&vh=11111":                                "youtu.be/jNQXAC9IVRw|11111|mp4",
+		"/play?u=https%3A%2F%2Fsite.com%2Fv%3Fa%3D1%3F%2F%3Fvh%3D1%26vf%3Dm4a&vh=360": "site.com/v?a=1?/?vh=1&vf=m4a|360|",
+		"/play?vf=m4a&u=youtu.be%2FjNQXAC9IVRw":                                       "youtu.be/jNQXAC9IVRw|0|m4a",
+		"/play?u=aHR0cHM6Ly95b3V0dS5iZS9qTlFYQUM5SVZSdz9hPTEmdmg9MQ&vh=240":           "youtu.be/jNQXAC9IVRw?a=1&vh=1|240|",
+		"/play?u=aHR0cHM6Ly95b3V0dS5iZS9qTlFYQUM5SVZSdz9hPTEmdmg9MQ==":                "youtu.be/jNQXAC9IVRw?a=1&vh=1|0|",
+		"/play?vh=360": "|360|",
 	}
 	for k, v := range testPairs {
 		l, h, f := parseQuery(k)
@@ -24,6 +43,73 @@ func TestParseQuery(t *testing.T) {
 	}
 }
 
+func TestRouteLink(t *testing.T) {
+	r := &http.Request{Host: "h"}
+	link := "www.youtube.com/watch?v=a?/?vh=1&vf=m4a"
+	res := (&AppLogic{}).routeLink(r, "play", link, "vh=360")
+	u, err := url.Parse(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l, h, f := parseQuery(u.RequestURI()); l != link || h != 360 || f != "" {
+		t.Error("For", res, "expected", link, 360, "got", l, h, f)
+	}
+}
+
+func TestSegmentLink(t *testing.T) {
+	link := "site.com/v"
+	for _, v := range []struct {
+		uri string
+		ok  bool
+	}{
+		{"/play?u=site.com%2Fv&vh=360&seg=" + segmentMAC(link), true},
+		{"/play/site.com/v?/?seg=" + segmentMAC(link), true},
+		{"/play?u=site.com%2Fw&seg=" + segmentMAC(link), false},
+		{"/play?u=site.com%2Fv&seg=abc", false},
+		{"/play?u=site.com%2Fv", false},
+	} {
+		r := &http.Request{Host: "h", RequestURI: v.uri}
+		l, _ := splitQuery(v.uri)
+		if ok := isSegment(r, l); ok != v.ok {
+			t.Error("For", v.uri, "expected", v.ok, "got", ok)
+		}
+	}
+}
+
+func TestLimitPlaySegment(t *testing.T) {
+	log, err := empty.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rate, burst, streams, zr, fls := 1.0, uint64(1), uint64(1), 0.0, false
+	limits := limiter.New(limiter.ConfigT{PlayRate: &rate, PlayBurst: &burst,
+		ExtractRate: &zr, ExtractBurst: new(uint64), ClientStreams: &streams,
+		Streams: new(uint64), ErrorMedia: &fls})
+	logic, err := New(Option{Name: "default"}, nil, Global{Limits: limits})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &http.Request{RemoteAddr: "1.2.3.4"}
+	now := time.Now()
+	release, err := logic.limitPlay(r, false, now, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := logic.limitPlay(r, true, now, log); err == nil {
+		t.Error("expected segment to take stream slot")
+	}
+	release()
+	if _, err := logic.limitPlay(r, false, now, log); err == nil {
+		t.Error("expected play rate limit")
+	}
+	release, err = logic.limitPlay(r, true, now, log)
+	if err != nil {
+		t.Error("expected segment without play token, got", err)
+	} else {
+		release()
+	}
+}
+
 func TestRemoveHttp(t *testing.T) {
 	for _, v := range []struct {
 		link string
@@ -61,3 +147,363 @@ func TestParseHost(t *testing.T) {
 	}
 
 }
+
+func TestMakeM3U(t *testing.T) {
+	entries := []extractor.InfoT{
+		{ID: "a", Title: "First\nvideo", URL: "https://www.youtube.com/watch?v=a",
+			Duration: 61.5, Thumbnail: "https://i.ytimg.com/a.jpg"},
+		{ID: "b", URL: "https://www.youtube.com/watch?v=b"},
+		{ID: "c", Title: "no url"},
+	}
+	want := `#EXTM3U
+#EXTINF:61 tvg-logo="https://i.ytimg.com/a.jpg",First video
+http://h/play/www.youtube.com/watch?v=a?/?vh=360
+#EXTINF:-1,b
+http://h/play/www.youtube.com/watch?v=b?/?vh=360
+`
+	r := makeM3U(entries, func(link string) string {
+		return "http://h/play/" + link + "?/?vh=360"
+	})
+	if r != want {
+		t.Error("expected", want, "got", r)
+	}
+}
+
+func TestSelectThumbnail(t *testing.T) {
+	info := extractor.InfoT{
+		Thumbnail: "https://i.ytimg.com/vi_webp/a/maxresdefault.webp",
+		Thumbnails: []extractor.ThumbnailT{
+			{URL: "https://i.ytimg.com/vi/a/default.jpg", Width: 120},
+			{URL: "https://i.ytimg.com/vi_webp/a/sddefault.webp", Width: 640},
+			{URL: "https://i.ytimg.com/vi/a/hqdefault.jpg?sqp=1", Width: 480},
+			{URL: "https://i.ytimg.com/vi/a/maxresdefault.jpg", Width: 1280},
+		},
+	}
+	for _, v := range []struct {
+		width int
+		want  string
+	}{
+		{width: 0, want: "https://i.ytimg.com/vi/a/maxresdefault.jpg"},
+		{width: 100, want: "https://i.ytimg.com/vi/a/default.jpg"},
+		{width: 320, want: "https://i.ytimg.com/vi/a/hqdefault.jpg?sqp=1"},
+		{width: 4000, want: "https://i.ytimg.com/vi/a/maxresdefault.jpg"},
+	} {
+		if r := selectThumbnail(info, v.width); r != v.want {
+			t.Error("For", v.width, "expected", v.want, "got", r)
+		}
+	}
+	info.Thumbnails = nil
+	if r := selectThumbnail(info, 0); r != info.Thumbnail {
+		t.Error("expected fallback to", info.Thumbnail, "got", r)
+	}
+}
+
+func TestThumbnailWidth(t *testing.T) {
+	for k, v := range map[int]int{-1: 0, 0: 0, 1: 120, 320: 320, 321: 480, 100000: 1280} {
+		if r := thumbnailWidth(k); r != v {
+			t.Error("For", k, "expected", v, "got", r)
+		}
+	}
+}
+
+func TestSelectProfile(t *testing.T) {
+	logic, err := New(Option{Name: "default"}, []Option{
+		{Name: "radio", Selectable: true},
+		{Name: "tv", Sites: []string{"*.youtube.com"}, Selectable: true},
+		{Name: "site", Sites: []string{"site.com"}},
+	}, Global{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []struct {
+		profile string
+		link    string
+		want    string
+	}{
+		{"radio", "site.com/v", "radio"},
+		{"tv", "www.youtube.com/watch?v=a", "tv"},
+		{"tv", "site.com/v", ""},
+		{"site", "site.com/v", ""},
+		{"unknown", "site.com/v", ""},
+		{"", "site.com/v", "site"},
+		{"", "other.com/v", "default"},
+	} {
+		var (
+			a   app
+			err error
+		)
+		if v.profile != "" {
+			a, _, err = logic.selectProfile(v.profile, v.link)
+		} else {
+			a, _, err = logic.selectApp(v.link)
+		}
+		if (err != nil) != (v.want == "") || a.name != v.want {
+			t.Error("For", v.profile, v.link, "expected", v.want, "got", a.name, err)
+		}
+	}
+}
+
+func TestDeviceSubConfig(t *testing.T) {
+	log, err := empty.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := []Option{
+		{Name: "tv", Sites: []string{"*.youtube.com"}},
+		{Name: "site", Sites: []string{"site.com"}},
+	}
+	var devices device.ListT
+	if err := json.Unmarshal([]byte(`[{"name": "lan", "cidr": ["192.168.1.0/24"],
+		"sub-config": "tv"}]`), &devices); err != nil {
+		t.Fatal(err)
+	}
+	logic, err := New(Option{Name: "default"}, opts, Global{Devices: devices})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []struct {
+		addr, link, want string
+	}{
+		{"192.168.1.5:1000", "www.youtube.com/watch?v=a", "tv"},
+		{"192.168.1.5:1000", "site.com/v", "site"},
+		{"192.168.1.5:1000", "other.com/v", "default"},
+		{"10.0.0.1:1000", "site.com/v", "site"},
+	} {
+		r := httptest.NewRequest("GET", "/play/"+v.link, nil)
+		r.RemoteAddr = v.addr
+		a, _, _, err := logic.selectRequest(r, auth.TokenT{}, v.link, 0, "", "", log)
+		if err != nil || a.name != v.want {
+			t.Error("For", v.addr, v.link, "expected", v.want, "got", a.name, err)
+		}
+	}
+	if err := json.Unmarshal([]byte(`[{"name": "lan", "cidr": ["192.168.1.0/24"],
+		"sub-config": "unknown"}]`), &devices); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(Option{Name: "default"}, opts, Global{Devices: devices}); err == nil {
+		t.Error("expected unknown device sub-config error")
+	}
+}
+
+func TestFixRequestDevice(t *testing.T) {
+	a := app{defaultVideoHeight: 720, maxVideoHeight: 720}
+	box := a.withDevice(device.ProfileT{DefaultVideoHeight: 360, MaxVideoHeight: 480,
+		DefaultFormat: "m4a"})
+	for _, v := range []struct {
+		a      app
+		height uint64
+		format string
+		want   string
+	}{
+		{a, 0, "", "720|mp4"},
+		{a, 1080, "m4a", "720|m4a"},
+		{box, 0, "", "360|m4a"},
+		{box, 720, "mp4", "480|mp4"},
+	} {
+		req := v.a.fixRequest("site.com", v.height, v.format)
+		if r := req.HEIGHT + "|" + req.FORMAT; r != v.want {
+			t.Error("For", v.height, v.format, "expected", v.want, "got", r)
+		}
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	var tokens auth.ListT
+	if err := json.Unmarshal([]byte(`[{"token": "abc", "label": "tv"}]`), &tokens); err != nil {
+		t.Fatal(err)
+	}
+	logic, err := New(Option{Name: "default"}, nil, Global{Tokens: tokens})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []struct {
+		uri    string
+		header string
+		ok     bool
+		link   string
+	}{
+		{"/play/abc/youtu.be/x?/?vh=360", "", true, "http://h/play?u=a&token=abc"},
+		{"/play?u=youtu.be%2Fx&token=abc", "", true, "http://h/play?u=a&token=abc"},
+		{"/play/youtu.be/x", "Bearer abc", true, "http://h/play?u=a&token=abc"},
+		{"/play/youtu.be/x?/?token=xyz", "", false, ""},
+		{"/play/youtu.be/x", "", false, ""},
+	} {
+		r := &http.Request{Host: "h", RequestURI: v.uri, Header: http.Header{}}
+		if v.header != "" {
+			r.Header.Set("Authorization", v.header)
+		}
+		option := requestOption(r, tokenOption)
+		if _, ok := logic.authorize(r, option); ok != v.ok {
+			t.Error("For", v.uri, "expected", v.ok, "got", ok)
+			continue
+		}
+		if link := logic.playLink(r, "a", ""); v.ok && link != v.link {
+			t.Error("For", v.uri, "expected", v.link, "got", link)
+		}
+	}
+	log, err := empty.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("POST", "/dlna/control/ContentDirectory", nil)
+	if _, err := logic.Entries(r, "https://site.com/c", "vf=m4a", log); err == nil {
+		t.Error("expected unauthorized entries")
+	}
+	want := "http://example.com/play?u=site.com%2Fa&token=abc&vf=m4a"
+	if link := logic.PlayLink(r, "https://site.com/a", "vf=m4a&token=abc"); link != want {
+		t.Error("expected", want, "got", link)
+	}
+	if logic.Authorize(r, "") || logic.Authorize(r, "xyz") {
+		t.Error("expected unauthorized DLNA request")
+	}
+	if !logic.Authorize(r, "abc") {
+		t.Error("expected authorized DLNA request")
+	}
+	if link := logic.PlayLink(r, "https://site.com/a", "vf=m4a"); link != want {
+		t.Error("expected DLNA token in", want, "got", link)
+	}
+}
+
+func TestSignedLink(t *testing.T) {
+	keys := []string{"key-0123456789abcdef"}
+	env, required, expire := "", true, "1h"
+	signer, err := sign.New(sign.ConfigT{Keys: &keys, KeysEnv: &env,
+		Required: &required, ExpireTime: &expire})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tokens auth.ListT
+	if err := json.Unmarshal([]byte(`[{"token": "abc"}]`), &tokens); err != nil {
+		t.Fatal(err)
+	}
+	logic, err := New(Option{Name: "default"}, nil, Global{Tokens: tokens, Signer: signer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri, err := SignedURI(signer, rewrite.T{}, "play", "https://site.com/v",
+		url.Values{"vh": {"360"}}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := SignedURI(signer, rewrite.T{}, "info", "site.com/v", nil, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SignedURI(signer, rewrite.T{}, "sign", "site.com/v", nil,
+		time.Now().Add(time.Hour)); err == nil {
+		t.Error("expected /sign route to be rejected")
+	}
+	expired, _ := SignedURI(signer, rewrite.T{}, "play", "site.com/v", nil,
+		time.Now().Add(-time.Hour))
+	for _, v := range []struct {
+		uri string
+		ok  bool
+	}{
+		{uri, true},
+		{strings.Replace(uri, "site.com", "other.com", 1), false},
+		{strings.Replace(uri, "vh=360", "vh=2160", 1), false},
+		{uri + "&profile=x", false},
+		{uri + "&token=xyz", true},
+		{expired, false},
+		{"/play?u=site.com%2Fv", false},
+	} {
+		r := &http.Request{Host: "h", RequestURI: v.uri, Header: http.Header{}}
+		if signed, err := logic.verify(r); (signed && err == nil) != v.ok {
+			t.Error("For", v.uri, "expected", v.ok, "got", signed, err)
+		}
+		if _, ok := logic.authorize(r, requestOption(r, tokenOption)); ok != v.ok {
+			t.Error("For", v.uri, "expected authorized", v.ok, "got", ok)
+		}
+	}
+	log, err := empty.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []struct {
+		uri    string
+		status int
+	}{
+		{"/play/abc" + strings.TrimPrefix(uri, "/play"), http.StatusOK},
+		{"/info/abc" + strings.TrimPrefix(uri, "/play"), http.StatusForbidden},
+		{"/info" + strings.TrimPrefix(uri, "/play"), http.StatusUnauthorized},
+		{info, http.StatusOK},
+		{"/play" + strings.TrimPrefix(info, "/info"), http.StatusUnauthorized},
+		{"/info/abc?u=site.com%2Fv", http.StatusForbidden},
+		{"/hls?u=site.com%2Fv", http.StatusUnauthorized},
+	} {
+		w := httptest.NewRecorder()
+		_, _, _, ok := logic.request(w, httptest.NewRequest("GET", v.uri, nil), log)
+		if ok != (v.status == http.StatusOK) || w.Code != v.status {
+			t.Error("For", v.uri, "expected", v.status, "got", ok, w.Code)
+		}
+	}
+	r := &http.Request{Host: "h", RequestURI: uri, Header: http.Header{}}
+	for _, v := range []string{"site.com/v", "site.com/w"} {
+		link := logic.playLink(r, v, "vh=720&sig=x&exp=1")
+		u, err := url.Parse(link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g := &http.Request{Host: "h", RequestURI: u.RequestURI(), Header: http.Header{}}
+		if signed, err := logic.verify(g); !signed || err != nil {
+			t.Error("For", link, "expected signed link, got", signed, err)
+		}
+		if exp := u.Query().Get(expOption); exp != requestOption(r, expOption) {
+			t.Error("For", link, "expected request expiry, got", exp)
+		}
+	}
+	open, err := New(Option{Name: "default"}, nil, Global{Signer: signer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	open.Search(w, httptest.NewRequest("GET", "/search/?q=a", nil), log)
+	if w.Code != http.StatusForbidden {
+		t.Error("expected forbidden search without tokens, got", w.Code)
+	}
+	unsigned, err := New(Option{Name: "default"}, nil, Global{AdminToken: "adm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	unsigned.Sign(w, httptest.NewRequest("GET", "/sign?u=site.com%2Fv&token=adm", nil), log)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Error("expected unavailable signing without keys, got", w.Code)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	log, err := empty.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := sessions.New()
+	logic, err := New(Option{Name: "default"}, nil, Global{Sessions: registry, AdminToken: "adm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	killed := false
+	registry.Start(sessions.InfoT{Client: "1.2.3.4", URL: "site.com/<v>"}, func() { killed = true })
+	for _, v := range []struct {
+		method string
+		uri    string
+		status int
+		body   string
+	}{
+		{"GET", "/admin/sessions", http.StatusUnauthorized, ""},
+		{"GET", "/admin/sessions?token=adm", http.StatusOK, `"client":"1.2.3.4"`},
+		{"GET", "/admin/sessions?token=adm&fmt=html", http.StatusOK, "<td>site.com/&lt;v&gt;</td>"},
+		{"GET", "/admin/sessions/kill?token=adm&id=1", http.StatusMethodNotAllowed, ""},
+		{"POST", "/admin/sessions/kill?token=adm&id=2", http.StatusNotFound, ""},
+		{"POST", "/admin/sessions/kill?token=adm&id=1&fmt=html", http.StatusSeeOther, ""},
+	} {
+		w := httptest.NewRecorder()
+		logic.Sessions(w, httptest.NewRequest(v.method, v.uri, nil), log)
+		if w.Code != v.status || !strings.Contains(w.Body.String(), v.body) {
+			t.Error("For", v.method, v.uri, "expected", v.status, v.body, "got", w.Code, w.Body)
+		}
+	}
+	if !killed {
+		t.Error("expected killed session")
+	}
+}
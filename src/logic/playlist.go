@@ -0,0 +1,146 @@
+package logic
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	auth "ytproxy/auth"
+	cache "ytproxy/cache"
+	extractor "ytproxy/extractor"
+	logger "ytproxy/logger"
+	logger_mux "ytproxy/logger/mux"
+)
+
+const m3uContentType = "audio/x-mpegurl"
+
+// Playlist serves playlist, channel or search link as M3U of /play/ links
+func (t *AppLogic) Playlist(w http.ResponseWriter, r *http.Request, log logger.T) {
+	log = logger_mux.NewLayer(log, fmt.Sprintf("App %s", r.RemoteAddr))
+	log.LogInfo("Playlist request", "url", r.RequestURI)
+	miniApp, req, miniAppLog, ok := t.request(w, r, log)
+	if !ok {
+		return
+	}
+	info, err := miniApp.playlist(req, time.Now(), miniAppLog)
+	if err != nil {
+		extractError(w, err, miniAppLog)
+		return
+	}
+	w.Header().Set("Content-Type", m3uContentType)
+	m3u := makeM3U(info.Entries, func(link string) string {
+		return t.playLink(r, link, queryOptions(r.RequestURI))
+	})
+	if _, err := io.WriteString(w, m3u); err != nil {
+		miniAppLog.LogError("Playlist write", "error", err)
+	}
+}
+
+// Entries returns playlist or channel entries of link for client of r,
+// authorized and limited like /playlist/ request with options.
+// Link comes from config, so it is not signed
+func (t *AppLogic) Entries(r *http.Request, link string, options string,
+	log logger.T) ([]extractor.InfoT, error) {
+	opts, _ := url.ParseQuery(options)
+	token, ok := t.authorize(r, opts.Get(tokenOption))
+	if !ok {
+		return nil, fmt.Errorf("missing or invalid token")
+	}
+	if token.Label != "" {
+		log = logger_mux.NewLayer(log, fmt.Sprintf("Token %s", token.Label))
+	}
+	miniApp, req, miniAppLog, err := t.selectRequest(r, token, removeHTTP(link), 0, "",
+		opts.Get(profileOption), log)
+	if err != nil {
+		return nil, err
+	}
+	info, err := miniApp.playlist(req, time.Now(), miniAppLog)
+	return info.Entries, err
+}
+
+// Authorize checks DLNA client token as link routes do,
+// it is kept in r for Entries and PlayLink
+func (t *AppLogic) Authorize(r *http.Request, token string) bool {
+	if token != "" {
+		auth.SetBearer(r, token)
+	}
+	_, ok := t.authorize(r, token)
+	return ok
+}
+
+// PlayLink makes /play/ link of link for client of r,
+// signed if signing keys are set
+func (t *AppLogic) PlayLink(r *http.Request, link string, options string) string {
+	return t.playLink(r, removeHTTP(link), options)
+}
+
+// playlist returns cached or freshly extracted flat playlist
+func (t *app) playlist(
+	req extractor.RequestT,
+	now time.Time,
+	log logger.T,
+) (extractor.InfoT, error) {
+	return t.meta(t.playlistCache, req.URL, now, log,
+		func() (extractor.InfoT, error) {
+			return t.extractor.Playlist(req, log)
+		})
+}
+
+// meta returns metadata from c or from extract func adding it to c
+func (t *app) meta(
+	c cache.MetaT,
+	key string,
+	now time.Time,
+	log logger.T,
+	extract func() (extractor.InfoT, error),
+) (extractor.InfoT, error) {
+	if expired := c.CleanExpired(now); len(expired) > 0 {
+		log.LogDebug("Expired", "metadata", expired)
+	}
+	if info, ok := c.Get(key); ok {
+		log.LogDebug("Metadata already cached", "key", key)
+		return info, nil
+	}
+	info, err := extract()
+	if err != nil {
+		log.LogError("Metadata extract", "error", err)
+		return info, err
+	}
+	log.LogDebug("Extractor returned metadata", "title", info.Title,
+		"entries", len(info.Entries))
+	c.Add(key, info, now)
+	return info, nil
+}
+
+// makeM3U makes extended M3U, link turns entry link into playable url
+func makeM3U(entries []extractor.InfoT, link func(string) string) string {
+	var b strings.Builder
+	fmt.Fprintln(&b, "#EXTM3U")
+	for _, v := range entries {
+		if v.URL == "" {
+			continue
+		}
+		duration := int64(v.Duration)
+		if duration <= 0 {
+			duration = -1
+		}
+		title := m3uEscape(v.Title)
+		if title == "" {
+			title = v.ID
+		}
+		fmt.Fprintf(&b, "#EXTINF:%d", duration)
+		if v.Thumbnail != "" {
+			fmt.Fprintf(&b, " tvg-logo=%q", m3uEscape(v.Thumbnail))
+		}
+		fmt.Fprintf(&b, ",%s\n", title)
+		fmt.Fprintln(&b, link(removeHTTP(v.URL)))
+	}
+	return b.String()
+}
+
+func m3uEscape(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,138 @@
+package logic
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	extractor "ytproxy/extractor"
+	logger "ytproxy/logger"
+	accesslog "ytproxy/logger/access"
+	logger_mux "ytproxy/logger/mux"
+)
+
+const (
+	defaultSearchCount = 20
+	maxSearchCount     = 100
+)
+
+type searchEntryT struct {
+	ID        string  `json:"id"`
+	Title     string  `json:"title"`
+	URL       string  `json:"url"`
+	Duration  float64 `json:"duration,omitempty"`
+	Thumbnail string  `json:"thumbnail,omitempty"`
+	Play      string  `json:"play"`
+}
+
+// Search serves extractor search results as M3U or JSON list of /play/ links.
+// Request is "/search/?q=<query>&n=<count>&fmt=<m3u|json>&site=<host>",
+// site selects sub-config, vh and vf are passed to play links.
+func (t *AppLogic) Search(w http.ResponseWriter, r *http.Request, log logger.T) {
+	log = logger_mux.NewLayer(log, fmt.Sprintf("App %s", r.RemoteAddr))
+	log.LogInfo("Search request", "url", r.RequestURI)
+	q := r.URL.Query()
+	req := extractor.SearchT{
+		QUERY: strings.TrimSpace(q.Get("q")),
+		COUNT: defaultSearchCount,
+	}
+	if req.QUERY == "" {
+		http.Error(w, "empty search query", http.StatusBadRequest)
+		return
+	}
+	if n, err := strconv.ParseUint(q.Get("n"), 10, 64); err == nil && n > 0 {
+		req.COUNT = n
+	}
+	if req.COUNT > maxSearchCount {
+		req.COUNT = maxSearchCount
+	}
+	token, ok := t.authorize(r, q.Get(tokenOption))
+	if !ok {
+		log.LogWarning("", "error", "missing or invalid token")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if t.signer.Required() && !t.tokens.Enabled() {
+		// search has no signed link, but its results are signed
+		log.LogWarning("", "error", "search needs API tokens when signed links are required")
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	miniApp := t.defaultApp
+	var err error
+	switch site, profile := q.Get("site"), q.Get(profileOption); {
+	case profile != "":
+		miniApp, _, err = t.selectProfile(profile, site)
+	case site != "":
+		miniApp, _, err = t.selectApp(site)
+	}
+	if err == nil {
+		err = miniApp.allowed(r, token)
+	}
+	if err != nil {
+		log.LogWarning("", "error", err)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	miniApp = t.withRequest(miniApp, r)
+	entry := accesslog.Entry(r.Context())
+	entry.SetUser(token.Label)
+	entry.SetSubConfig(miniApp.name)
+	miniAppLog := logger_mux.NewLayer(log, fmt.Sprintf("[%s]", miniApp.name))
+	log.LogInfo("", "search", req, "app", miniApp.name, "token", token.Label)
+	key := fmt.Sprintf("search|%d|%s", req.COUNT, req.QUERY)
+	info, err := miniApp.meta(miniApp.playlistCache, key, time.Now(), miniAppLog,
+		func() (extractor.InfoT, error) {
+			return miniApp.extractor.Search(req, miniAppLog)
+		})
+	if err != nil {
+		extractError(w, err, miniAppLog)
+		return
+	}
+	options := make(url.Values)
+	for _, k := range []string{"vh", "vf", profileOption, tokenOption} {
+		if v := q.Get(k); v != "" {
+			options.Set(k, v)
+		}
+	}
+	link := func(link string) string {
+		return t.playLink(r, link, options.Encode())
+	}
+	var body string
+	switch q.Get("fmt") {
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		list := make([]searchEntryT, 0, len(info.Entries))
+		for _, v := range info.Entries {
+			if v.URL == "" {
+				continue
+			}
+			list = append(list, searchEntryT{
+				ID:        v.ID,
+				Title:     v.Title,
+				URL:       v.URL,
+				Duration:  v.Duration,
+				Thumbnail: v.Thumbnail,
+				Play:      link(removeHTTP(v.URL)),
+			})
+		}
+		b, err := json.Marshal(list)
+		if err != nil {
+			miniAppLog.LogError("Search json", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body = string(b)
+	default:
+		w.Header().Set("Content-Type", m3uContentType)
+		body = makeM3U(info.Entries, link)
+	}
+	if _, err := io.WriteString(w, body); err != nil {
+		miniAppLog.LogError("Search write", "error", err)
+	}
+}
@@ -0,0 +1,114 @@
+package logic
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	logger "ytproxy/logger"
+	logger_mux "ytproxy/logger/mux"
+	sessions "ytproxy/sessions"
+)
+
+const sessionsRefresh = 5
+
+var sessionsPage = template.Must(template.New("sessions").Funcs(template.FuncMap{
+	"size": func(v any) string {
+		var b float64
+		switch n := v.(type) {
+		case int64:
+			b = float64(n)
+		case float64:
+			b = n
+		}
+		units := []string{"B", "KiB", "MiB", "GiB"}
+		i := 0
+		for ; b >= 1024 && i < len(units)-1; i++ {
+			b /= 1024
+		}
+		return fmt.Sprintf("%.1f %s", b, units[i])
+	},
+	"since": func(start, now time.Time) string {
+		return now.Sub(start).Round(time.Second).String()
+	},
+}).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8">
+<meta http-equiv="refresh" content="{{.Refresh}}">
+<title>yt-proxy sessions</title>
+<style>body{font-family:sans-serif}td,th{padding:2px 8px;text-align:left}</style>
+</head><body>
+<h3>Sessions: {{len .List}}</h3>
+<table>
+<tr><th>ID</th><th>Client</th><th>Sub-config</th><th>URL</th><th>Height</th>` +
+	`<th>Format</th><th>Cache</th><th>Time</th><th>Sent</th><th>Speed</th><th></th></tr>
+{{range .List}}<tr><td>{{.ID}}</td><td>{{.Client}}</td><td>{{.SubConfig}}</td>` +
+	`<td>{{.URL}}</td><td>{{.Height}}</td><td>{{.Format}}</td>` +
+	`<td>{{if .CacheHit}}hit{{else}}miss{{end}}</td><td>{{since .Start $.Now}}</td>` +
+	`<td>{{size .Bytes}}</td><td>{{size .Throughput}}/s</td>
+<td><form method="post" action="/admin/sessions/kill?{{$.Query}}&amp;id={{.ID}}">` +
+	`<button>kill</button></form></td></tr>
+{{end}}</table></body></html>
+`))
+
+// Sessions serves active /play/ sessions for admin.
+// "/admin/sessions" is JSON list, "/admin/sessions?fmt=html" is auto-refreshing
+// page, POST "/admin/sessions/kill?id=<id>" cancels session
+func (t *AppLogic) Sessions(w http.ResponseWriter, r *http.Request, log logger.T) {
+	log = logger_mux.NewLayer(log, fmt.Sprintf("App %s", r.RemoteAddr))
+	if !t.admin(r) {
+		log.LogWarning("Sessions request", "error", "missing or invalid admin token")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	q := r.URL.Query()
+	html := q.Get("fmt") == "html"
+	if strings.HasSuffix(r.URL.Path, "/kill") {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		id, _ := strconv.ParseUint(q.Get("id"), 10, 64)
+		killed := t.sessions.Kill(id)
+		log.LogInfo("Session kill", "id", id, "killed", killed)
+		if html {
+			q.Del("id")
+			http.Redirect(w, r, "/admin/sessions?"+q.Encode(), http.StatusSeeOther)
+			return
+		}
+		if !killed {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	now := time.Now()
+	list := t.sessions.List(now)
+	if html {
+		// kill form and refresh keep token and fmt
+		query := url.Values{"fmt": {"html"}}
+		if token := q.Get(tokenOption); token != "" {
+			query.Set(tokenOption, token)
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := sessionsPage.Execute(w, struct {
+			Refresh int
+			Query   template.URL
+			Now     time.Time
+			List    []sessions.InfoT
+		}{sessionsRefresh, template.URL(query.Encode()), now, list}); err != nil {
+			log.LogError("Sessions page", "error", err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		log.LogError("Sessions write", "error", err)
+	}
+}
@@ -0,0 +1,170 @@
+package logic
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	logger "ytproxy/logger"
+	logger_mux "ytproxy/logger/mux"
+	rewrite "ytproxy/rewrite"
+	sign "ytproxy/sign"
+)
+
+const (
+	sigOption    = "sig"
+	expOption    = "exp"
+	expireOption = "expire"
+	routeOption  = "route"
+	signedLabel  = "signed link"
+)
+
+// signedRoutes are link routes signed links may be made for
+var signedRoutes = map[string]bool{
+	"play": true, "hls": true, "playlist": true, "feed": true,
+	"info": true, "thumb": true, "subs": true,
+}
+
+// verify checks sig and exp options of request against its route,
+// normalized link and options.
+// Returns true if request is signed, unsigned requests are accepted
+// if signing is not required
+func (t *AppLogic) verify(r *http.Request) (bool, error) {
+	sig, exp := requestOption(r, sigOption), requestOption(r, expOption)
+	if sig == "" && exp == "" {
+		if t.signer.Required() {
+			return false, fmt.Errorf("missing signature")
+		}
+		return false, nil
+	}
+	link, options := splitQuery(r.RequestURI)
+	opts, err := signedOptions(options)
+	if err != nil {
+		return false, err
+	}
+	if err := t.signer.Verify(requestRoute(r), t.rewrite.Apply(link), opts, sig, exp, time.Now()); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// requestRoute returns first path element of request,
+// so link signed for one route does not open others
+func requestRoute(r *http.Request) string {
+	route := strings.TrimPrefix(r.RequestURI, "/")
+	if i := strings.IndexAny(route, "/?"); i >= 0 {
+		route = route[:i]
+	}
+	return route
+}
+
+// signedOptions returns options covered by signature,
+// token is not a part of link
+func signedOptions(options string) (url.Values, error) {
+	opts, err := url.ParseQuery(options)
+	if err != nil {
+		return nil, fmt.Errorf("invalid options: %s", err)
+	}
+	for _, v := range []string{sigOption, expOption, tokenOption} {
+		opts.Del(v)
+	}
+	return opts, nil
+}
+
+// linkExpire returns expiry of links generated for r,
+// they do not outlive signed request link
+func (t *AppLogic) linkExpire(r *http.Request, now time.Time) time.Time {
+	if t.signer == nil {
+		return now
+	}
+	res := now.Add(t.signer.ExpireTime())
+	if e, err := strconv.ParseInt(requestOption(r, expOption), 10, 64); err == nil &&
+		time.Unix(e, 0).Before(res) {
+		res = time.Unix(e, 0)
+	}
+	return res
+}
+
+// SignedURI makes "/<route>?u=<link>&<options>&exp=<unix time>&sig=<signature>"
+// request uri, link is normalized as in requests.
+// Signature covers route, link and options except token
+func SignedURI(s *sign.T, rw rewrite.T, route string, link string, options url.Values,
+	exp time.Time) (string, error) {
+	if s == nil {
+		return "", fmt.Errorf("signing keys are not set")
+	}
+	if !signedRoutes[route] {
+		return "", fmt.Errorf("route %q can not be signed", route)
+	}
+	link = rw.Apply(removeHTTP(link))
+	if link == "" {
+		return "", fmt.Errorf("empty link")
+	}
+	opts := url.Values{}
+	for k, v := range options {
+		opts[k] = v
+	}
+	token := opts.Get(tokenOption)
+	for _, v := range []string{sigOption, expOption, tokenOption} {
+		opts.Del(v)
+	}
+	sig, e := s.Sign(route, link, opts, exp)
+	opts.Set(expOption, e)
+	opts.Set(sigOption, sig)
+	if token != "" {
+		opts.Set(tokenOption, token)
+	}
+	return fmt.Sprintf("/%s?%s=%s&%s", route, linkOption, url.QueryEscape(link),
+		opts.Encode()), nil
+}
+
+// Sign serves signed link for admin.
+// Request is "/sign?u=<link>&expire=<duration>&route=<route>&<options>",
+// route is /play/ by default, options are added to signed link
+func (t *AppLogic) Sign(w http.ResponseWriter, r *http.Request, log logger.T) {
+	log = logger_mux.NewLayer(log, fmt.Sprintf("App %s", r.RemoteAddr))
+	log.LogInfo("Sign request")
+	if !t.admin(r) {
+		log.LogWarning("", "error", "missing or invalid admin token")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if t.signer == nil {
+		log.LogWarning("", "error", "signing keys are not set")
+		http.Error(w, "signing keys are not set", http.StatusServiceUnavailable)
+		return
+	}
+	q := r.URL.Query()
+	link := decodeLink(q.Get(linkOption))
+	expire := t.signer.ExpireTime()
+	if v := q.Get(expireOption); v != "" {
+		var err error
+		if expire, err = time.ParseDuration(v); err != nil || expire <= 0 {
+			http.Error(w, "invalid expire option", http.StatusBadRequest)
+			return
+		}
+	}
+	route := q.Get(routeOption)
+	if route == "" {
+		route = "play"
+	}
+	for _, v := range []string{linkOption, expireOption, routeOption, tokenOption,
+		sigOption, expOption} {
+		q.Del(v)
+	}
+	uri, err := SignedURI(t.signer, t.rewrite, route, link, q, time.Now().Add(expire))
+	if err != nil {
+		log.LogWarning("", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.LogInfo("Signed", "uri", uri, "expire", expire)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if _, err := io.WriteString(w, "http://"+r.Host+uri+"\n"); err != nil {
+		log.LogError("Sign write", "error", err)
+	}
+}
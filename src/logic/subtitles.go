@@ -0,0 +1,157 @@
+package logic
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	extractor "ytproxy/extractor"
+	logger "ytproxy/logger"
+	logger_mux "ytproxy/logger/mux"
+	subtitles "ytproxy/subtitles"
+)
+
+const (
+	maxSubtitlesSize   = 8 << 20
+	srtContentType     = "application/x-subrip; charset=utf-8"
+	vttContentType     = "text/vtt; charset=utf-8"
+	subtitlesVTTFormat = "vtt"
+	subtitlesSRTFormat = "srt"
+)
+
+type subtitleLangT struct {
+	Lang string `json:"lang"`
+	Name string `json:"name"`
+	Auto bool   `json:"auto"`
+	Link string `json:"link"`
+}
+
+// Subtitles serves subtitles track as SRT ("fmt=vtt" option keeps WebVTT),
+// without "lang" option available languages are listed as JSON
+func (t *AppLogic) Subtitles(w http.ResponseWriter, r *http.Request, log logger.T) {
+	log = logger_mux.NewLayer(log, fmt.Sprintf("App %s", r.RemoteAddr))
+	log.LogInfo("Subtitles request", "url", r.RequestURI)
+	miniApp, req, miniAppLog, ok := t.request(w, r, log)
+	if !ok {
+		return
+	}
+	opts, err := url.ParseQuery(queryOptions(r.RequestURI))
+	if err != nil {
+		opts = make(url.Values)
+	}
+	format := opts.Get("fmt")
+	if format != subtitlesVTTFormat {
+		format = subtitlesSRTFormat
+	}
+	info, err := miniApp.info(req, time.Now(), miniAppLog)
+	if err != nil {
+		extractError(w, err, miniAppLog)
+		return
+	}
+	lang := opts.Get("lang")
+	if lang == "" {
+		list := listSubtitles(info.Subtitles, func(lang string) string {
+			return t.routeLink(r, "subs", req.URL,
+				url.Values{"lang": {lang}, "fmt": {format}}.Encode())
+		})
+		b, err := json.Marshal(list)
+		if err != nil {
+			miniAppLog.LogError("Subtitles json", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(b); err != nil {
+			miniAppLog.LogError("Subtitles write", "error", err)
+		}
+		return
+	}
+	track, ok := selectSubtitle(info.Subtitles, lang)
+	if !ok {
+		miniAppLog.LogWarning("No subtitles found", "lang", lang)
+		http.NotFound(w, r)
+		return
+	}
+	data, err := miniApp.subtitles(r, track, format, miniAppLog)
+	if err != nil {
+		miniAppLog.LogError("Subtitles", "error", err)
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+	if format == subtitlesVTTFormat {
+		w.Header().Set("Content-Type", vttContentType)
+	} else {
+		w.Header().Set("Content-Type", srtContentType)
+	}
+	if _, err := w.Write(data); err != nil {
+		miniAppLog.LogError("Subtitles write", "error", err)
+	}
+}
+
+// subtitles downloads track through streamer and converts it to format
+func (t *app) subtitles(r *http.Request, track extractor.SubtitleT,
+	format string, log logger.T) ([]byte, error) {
+	log.LogDebug("Subtitles download", "lang", track.Lang, "auto", track.Auto,
+		"url", track.URL)
+	res, err := t.streamer.Fetch(r, track.URL, "")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			log.LogError("body close", "error", err)
+		}
+	}()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("subtitles request failed: %s", res.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxSubtitlesSize))
+	if err != nil {
+		return nil, err
+	}
+	if format == subtitlesVTTFormat {
+		return data, nil
+	}
+	return subtitles.VTTToSRT(data)
+}
+
+// listSubtitles lists WebVTT tracks languages, link makes track link
+func listSubtitles(list []extractor.SubtitleT,
+	link func(string) string) []subtitleLangT {
+	res := make([]subtitleLangT, 0)
+	seen := make(map[string]bool)
+	for _, v := range list {
+		if v.Ext != subtitlesVTTFormat || seen[v.Lang] {
+			continue
+		}
+		seen[v.Lang] = true
+		res = append(res, subtitleLangT{
+			Lang: v.Lang,
+			Name: v.Name,
+			Auto: v.Auto,
+			Link: link(v.Lang),
+		})
+	}
+	return res
+}
+
+// selectSubtitle finds WebVTT track for lang, manual subtitles preferred
+func selectSubtitle(list []extractor.SubtitleT,
+	lang string) (extractor.SubtitleT, bool) {
+	var (
+		res   extractor.SubtitleT
+		found bool
+	)
+	for _, v := range list {
+		if v.Lang != lang || v.Ext != subtitlesVTTFormat {
+			continue
+		}
+		if !found || (res.Auto && !v.Auto) {
+			res, found = v, true
+		}
+	}
+	return res, found
+}
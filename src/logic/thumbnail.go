@@ -0,0 +1,141 @@
+package logic
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	extractor "ytproxy/extractor"
+	logger "ytproxy/logger"
+	logger_mux "ytproxy/logger/mux"
+	thumbnail "ytproxy/thumbnail"
+)
+
+const maxThumbnailSize = 16 << 20
+
+// thumbnailWidths are served widths, requested width is rounded up to one,
+// so clients cannot fill cache with every possible width
+var thumbnailWidths = []int{120, 160, 240, 320, 480, 640, 1280}
+
+// Thumbnail serves video thumbnail as JPEG over http,
+// "w" option downscales it to requested width rounded up to served one
+func (t *AppLogic) Thumbnail(w http.ResponseWriter, r *http.Request, log logger.T) {
+	log = logger_mux.NewLayer(log, fmt.Sprintf("App %s", r.RemoteAddr))
+	log.LogInfo("Thumbnail request", "url", r.RequestURI)
+	miniApp, req, miniAppLog, ok := t.request(w, r, log)
+	if !ok {
+		return
+	}
+	var width int
+	if opts, err := url.ParseQuery(queryOptions(r.RequestURI)); err == nil {
+		width, _ = strconv.Atoi(opts.Get("w"))
+	}
+	width = thumbnailWidth(width)
+	info, err := miniApp.info(req, time.Now(), miniAppLog)
+	if err != nil {
+		extractError(w, err, miniAppLog)
+		return
+	}
+	src := selectThumbnail(info, width)
+	if src == "" {
+		miniAppLog.LogWarning("No thumbnail found")
+		http.NotFound(w, r)
+		return
+	}
+	key := fmt.Sprintf("%s|%d", src, width)
+	img, ok := miniApp.thumbnailCache.Get(key)
+	if ok {
+		miniAppLog.LogDebug("Thumbnail already cached", "url", src)
+	} else {
+		if img, err = miniApp.thumbnail(r, src, width, miniAppLog); err != nil {
+			miniAppLog.LogError("Thumbnail", "error", err)
+			http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+			return
+		}
+		if err := miniApp.thumbnailCache.Add(key, img); err != nil {
+			miniAppLog.LogError("Thumbnail cache", "error", err)
+		}
+	}
+	w.Header().Set("Content-Type", thumbnail.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(img)))
+	if _, err := w.Write(img); err != nil {
+		miniAppLog.LogError("Thumbnail write", "error", err)
+	}
+}
+
+// thumbnailWidth rounds width up to served one,
+// zero is original width and too big widths are the biggest one
+func thumbnailWidth(width int) int {
+	if width <= 0 {
+		return 0
+	}
+	for _, v := range thumbnailWidths {
+		if width <= v {
+			return v
+		}
+	}
+	return thumbnailWidths[len(thumbnailWidths)-1]
+}
+
+// thumbnail downloads image through streamer and converts it
+func (t *app) thumbnail(r *http.Request, src string, width int,
+	log logger.T) ([]byte, error) {
+	log.LogDebug("Thumbnail download", "url", src, "width", width)
+	res, err := t.streamer.Fetch(r, src, "")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			log.LogError("body close", "error", err)
+		}
+	}()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("thumbnail request failed: %s", res.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxThumbnailSize))
+	if err != nil {
+		return nil, err
+	}
+	return thumbnail.Convert(data, width)
+}
+
+// selectThumbnail picks decodable (jpeg or png) thumbnail,
+// smallest not narrower than width or the biggest one
+func selectThumbnail(info extractor.InfoT, width int) string {
+	decodable := func(u string) bool {
+		p, err := url.Parse(u)
+		if err != nil {
+			return false
+		}
+		switch strings.ToLower(path.Ext(p.Path)) {
+		case ".jpg", ".jpeg", ".png":
+			return true
+		}
+		return false
+	}
+	var best *extractor.ThumbnailT
+	for k, v := range info.Thumbnails {
+		if !decodable(v.URL) {
+			continue
+		}
+		switch {
+		case best == nil:
+		case width > 0 && v.Width >= uint64(width) &&
+			(best.Width < uint64(width) || v.Width < best.Width):
+		case (width <= 0 || best.Width < uint64(width)) && v.Width >= best.Width:
+		default:
+			continue
+		}
+		best = &info.Thumbnails[k]
+	}
+	if best != nil {
+		return best.URL
+	}
+	return info.Thumbnail
+}
@@ -4,6 +4,7 @@ package main
 import (
 	"flag"
 	"os"
+	"time"
 
 	app "ytproxy/app"
 	utils "ytproxy/utils"
@@ -12,14 +13,22 @@ import (
 const appVersion = "2.3.1"
 
 type flagsT struct {
-	version bool
-	config  string
+	version     bool
+	config      string
+	sign        string
+	signRoute   string
+	signOptions string
+	signExpire  time.Duration
 }
 
 func parseCLIFlags() flagsT {
 	var f flagsT
 	flag.BoolVar(&f.version, "version", false, "prints current yt-proxy version")
 	flag.StringVar(&f.config, "config", "config.jsonc", "config file path")
+	flag.StringVar(&f.sign, "sign", "", "prints signed /play/ request uri for link and exits")
+	flag.StringVar(&f.signRoute, "sign-route", "play", "route of signed link, e.g. hls or info")
+	flag.StringVar(&f.signOptions, "sign-options", "", "options of signed link, e.g. vh=720&vf=mp4")
+	flag.DurationVar(&f.signExpire, "sign-expire", 0, "signed link lifetime (default signing expire-time)")
 	flag.Parse()
 	return f
 }
@@ -30,6 +39,15 @@ func main() {
 		utils.WriteStdoutLn(appVersion)
 		return
 	}
+	if flags.sign != "" {
+		uri, err := app.Sign(flags.config, flags.signRoute, flags.sign, flags.signOptions, flags.signExpire)
+		if err != nil {
+			utils.WriteError(err)
+			os.Exit(1)
+		}
+		utils.WriteStdoutLn(uri)
+		return
+	}
 	if err := app.Run(flags.config); err != nil {
 		utils.WriteError(err)
 		os.Exit(1)
@@ -0,0 +1,247 @@
+// Package mp4 builds segment index of fragmented mp4 files from sidx box
+package mp4
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	headSize      = 64 << 10
+	boxHeaderSize = 8
+	// maxSidxSize fits 65535 references sidx count field allows
+	maxSidxSize = 1 << 20
+)
+
+// ErrNotFragmented is returned for progressive files,
+// their mdat ranges are not independently decodable segments
+var ErrNotFragmented = errors.New("mp4 is not fragmented")
+
+// ReadF reads size bytes at offset
+type ReadF func(offset, size int64) ([]byte, error)
+
+// RangeT is file byte range
+type RangeT struct {
+	Offset int64
+	Length int64
+}
+
+// SegmentT is independently decodable file part
+type SegmentT struct {
+	RangeT
+	Duration float64
+}
+
+// IndexT is file index.
+// Init is initialization section (ftyp and moov boxes), segments come from sidx
+type IndexT struct {
+	Init     RangeT
+	Segments []SegmentT
+}
+
+type boxT struct {
+	typ    string
+	offset int64
+	size   int64
+	header int64
+}
+
+func (b boxT) end() int64 {
+	return b.offset + b.size
+}
+
+type reader struct {
+	read  ReadF
+	total int64
+	head  []byte
+}
+
+func (r *reader) at(offset, size int64) ([]byte, error) {
+	if offset+size > r.total {
+		return nil, fmt.Errorf("read beyond end of file")
+	}
+	if offset+size <= int64(len(r.head)) {
+		return r.head[offset : offset+size], nil
+	}
+	b, err := r.read(offset, size)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) != size {
+		return nil, fmt.Errorf("short read: wanted %d bytes, got %d", size, len(b))
+	}
+	return b, nil
+}
+
+func (r *reader) box(offset int64) (boxT, error) {
+	size := int64(16)
+	if r.total-offset < size {
+		size = r.total - offset
+	}
+	if size < boxHeaderSize {
+		return boxT{}, fmt.Errorf("truncated box at %d", offset)
+	}
+	h, err := r.at(offset, size)
+	if err != nil {
+		return boxT{}, err
+	}
+	b, err := parseBoxHeader(h, r.total-offset)
+	b.offset = offset
+	return b, err
+}
+
+func parseBoxHeader(h []byte, left int64) (boxT, error) {
+	b := boxT{
+		size:   int64(binary.BigEndian.Uint32(h)),
+		typ:    string(h[4:8]),
+		header: boxHeaderSize,
+	}
+	switch b.size {
+	case 0:
+		b.size = left
+	case 1:
+		if len(h) < 16 {
+			return b, fmt.Errorf("truncated %s box header", b.typ)
+		}
+		b.size = int64(binary.BigEndian.Uint64(h[8:]))
+		b.header = 16
+	}
+	if b.size < b.header || b.size > left {
+		return b, fmt.Errorf("bad %s box size %d", b.typ, b.size)
+	}
+	return b, nil
+}
+
+// Index reads top level boxes up to sidx and builds segment index from it.
+// Progressive files are refused with ErrNotFragmented at first mdat,
+// before their moov is read
+func Index(read ReadF, total int64) (IndexT, error) {
+	r := reader{read: read, total: total}
+	size := int64(headSize)
+	if total < size {
+		size = total
+	}
+	head, err := read(0, size)
+	if err != nil {
+		return IndexT{}, err
+	}
+	r.head = head
+	var moov, sidx *boxT
+	for offset := int64(0); offset < total && sidx == nil; {
+		b, err := r.box(offset)
+		if err != nil {
+			return IndexT{}, err
+		}
+		switch b.typ {
+		case "moov":
+			moov = &b
+		case "sidx":
+			sidx = &b
+		case "mdat":
+			return IndexT{}, ErrNotFragmented
+		case "moof":
+			return IndexT{}, fmt.Errorf("fragmented file without sidx")
+		}
+		offset = b.end()
+	}
+	switch {
+	case moov == nil:
+		return IndexT{}, fmt.Errorf("moov box not found before sidx")
+	case sidx == nil:
+		return IndexT{}, fmt.Errorf("sidx box not found")
+	case sidx.size > maxSidxSize:
+		return IndexT{}, fmt.Errorf("sidx box is too big: %d", sidx.size)
+	}
+	data, err := r.at(sidx.offset+sidx.header, sidx.size-sidx.header)
+	if err != nil {
+		return IndexT{}, err
+	}
+	segments, err := parseSidx(data, sidx.end())
+	return IndexT{
+		Init:     RangeT{Offset: 0, Length: sidx.offset},
+		Segments: segments,
+	}, err
+}
+
+// fullBox is big endian reader over full box payload
+type fullBox struct {
+	b   []byte
+	err error
+}
+
+func (f *fullBox) version() uint8 {
+	return f.b[0]
+}
+
+func (f *fullBox) take(n int) []byte {
+	if f.err != nil {
+		return make([]byte, n)
+	}
+	if len(f.b) < n {
+		f.err = fmt.Errorf("truncated box data")
+		return make([]byte, n)
+	}
+	r := f.b[:n]
+	f.b = f.b[n:]
+	return r
+}
+
+func (f *fullBox) skip(n int) {
+	f.take(n)
+}
+
+func (f *fullBox) u32() uint32 {
+	return binary.BigEndian.Uint32(f.take(4))
+}
+
+func (f *fullBox) u64() uint64 {
+	return binary.BigEndian.Uint64(f.take(8))
+}
+
+func parseSidx(b []byte, anchor int64) ([]SegmentT, error) {
+	if len(b) < 4 {
+		return nil, fmt.Errorf("truncated sidx")
+	}
+	f := &fullBox{b: b}
+	v := f.version()
+	f.skip(4)
+	f.skip(4)
+	timescale := f.u32()
+	var firstOffset uint64
+	if v == 0 {
+		f.skip(4)
+		firstOffset = uint64(f.u32())
+	} else {
+		f.skip(8)
+		firstOffset = f.u64()
+	}
+	f.skip(2)
+	count := int(binary.BigEndian.Uint16(f.take(2)))
+	if f.err != nil {
+		return nil, f.err
+	}
+	if timescale == 0 {
+		return nil, fmt.Errorf("sidx timescale is zero")
+	}
+	offset := anchor + int64(firstOffset)
+	res := make([]SegmentT, 0, count)
+	for i := 0; i < count; i++ {
+		ref := f.u32()
+		duration := f.u32()
+		f.skip(4)
+		if f.err != nil {
+			return nil, f.err
+		}
+		if ref>>31 != 0 {
+			return nil, fmt.Errorf("hierarchical sidx is not supported")
+		}
+		size := int64(ref & 0x7fffffff)
+		res = append(res, SegmentT{
+			RangeT:   RangeT{Offset: offset, Length: size},
+			Duration: float64(duration) / float64(timescale),
+		})
+		offset += size
+	}
+	return res, nil
+}
@@ -0,0 +1,84 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func box(typ string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	b := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(b, uint32(8+len(body)))
+	copy(b[4:], typ)
+	return append(b, body...)
+}
+
+func u32(list ...uint32) []byte {
+	b := make([]byte, 4*len(list))
+	for k, v := range list {
+		binary.BigEndian.PutUint32(b[4*k:], v)
+	}
+	return b
+}
+
+func readFrom(file []byte) ReadF {
+	return func(offset, size int64) ([]byte, error) {
+		return file[offset : offset+size], nil
+	}
+}
+
+func TestIndexSidx(t *testing.T) {
+	ftyp := box("ftyp", []byte("isom"))
+	moov := box("moov", box("mvhd", u32(0)))
+	sidx := box("sidx", u32(0, 1, 1000, 0, 0), []byte{0, 0, 0, 2},
+		u32(300, 5000, 0x90000000), u32(200, 4000, 0x90000000))
+	file := bytes.Join([][]byte{ftyp, moov, sidx, make([]byte, 500)}, nil)
+	idx, err := Index(readFrom(file), int64(len(file)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	init := int64(len(ftyp) + len(moov))
+	if idx.Init != (RangeT{Offset: 0, Length: init}) {
+		t.Fatal("bad init", idx)
+	}
+	first := init + int64(len(sidx))
+	for k, v := range []SegmentT{
+		{RangeT: RangeT{Offset: first, Length: 300}, Duration: 5},
+		{RangeT: RangeT{Offset: first + 300, Length: 200}, Duration: 4},
+	} {
+		if idx.Segments[k] != v {
+			t.Error("For", k, "expected", v, "got", idx.Segments[k])
+		}
+	}
+}
+
+func TestIndexProgressive(t *testing.T) {
+	ftyp := box("ftyp", []byte("isom"))
+	moov := box("moov", make([]byte, 2*headSize))
+	mdat := box("mdat", make([]byte, 600))
+	file := bytes.Join([][]byte{ftyp, moov, mdat}, nil)
+	read := func(offset, size int64) ([]byte, error) {
+		if offset > 0 && size > 16 {
+			t.Error("unexpected read of", size, "bytes at", offset)
+		}
+		return file[offset : offset+size], nil
+	}
+	if _, err := Index(read, int64(len(file))); err != ErrNotFragmented {
+		t.Error("expected", ErrNotFragmented, "got", err)
+	}
+}
+
+func TestIndexErrors(t *testing.T) {
+	for _, v := range [][]byte{
+		box("ftyp", []byte("isom")),
+		bytes.Join([][]byte{box("ftyp"), box("moov"), box("moof")}, nil),
+		bytes.Join([][]byte{box("mdat", make([]byte, 10)), box("moov")}, nil),
+		bytes.Join([][]byte{box("ftyp"), box("sidx", u32(0, 1, 1000, 0, 0))}, nil),
+		{0, 0, 0, 100, 'f', 't', 'y', 'p'},
+	} {
+		if _, err := Index(readFrom(v), int64(len(v))); err == nil {
+			t.Error("For", v, "expected error")
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Package rewrite normalizes links before sub-config selection and caching
+package rewrite
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const youtubeHost = "www.youtube.com"
+
+var defaultStripParams = []string{"si", "feature", "utm_*"}
+
+// T is ordered list of regex rewrite rules and built-in canonicalizers,
+// config value is {"rules": [{"match": .., "replace": ..}],
+// "canonicalize": bool, "strip-params": [..]}
+type T struct {
+	rules       []ruleT
+	noCanonical bool
+	stripParams []string
+}
+
+type ruleT struct {
+	re      *regexp.Regexp
+	replace string
+}
+
+type configT struct {
+	Rules []struct {
+		Match   string `json:"match"`
+		Replace string `json:"replace"`
+	} `json:"rules"`
+	Canonicalize *bool     `json:"canonicalize"`
+	StripParams  *[]string `json:"strip-params"`
+}
+
+// UnmarshalJSON is custom json unmarshal func, do not use directly
+func (t *T) UnmarshalJSON(b []byte) error {
+	var c configT
+	if err := json.Unmarshal(b, &c); err != nil {
+		return err
+	}
+	t.rules = make([]ruleT, 0, len(c.Rules))
+	for _, v := range c.Rules {
+		re, err := regexp.Compile(v.Match)
+		if err != nil {
+			return fmt.Errorf("rewrite rule %q: %s", v.Match, err)
+		}
+		t.rules = append(t.rules, ruleT{re: re, replace: v.Replace})
+	}
+	if c.Canonicalize != nil {
+		t.noCanonical = !*c.Canonicalize
+	}
+	if c.StripParams != nil {
+		t.stripParams = *c.StripParams
+	}
+	return nil
+}
+
+// Apply rewrites link without scheme: config rules in order,
+// then built-in canonicalizers, then tracking params removal
+func (t T) Apply(link string) string {
+	for _, v := range t.rules {
+		link = v.re.ReplaceAllString(link, v.replace)
+	}
+	if !t.noCanonical {
+		link = canonicalize(link)
+	}
+	strip := t.stripParams
+	if strip == nil {
+		strip = defaultStripParams
+	}
+	return stripParams(link, strip)
+}
+
+// canonicalize turns YouTube short, mobile, music, shorts,
+// live and embed links into www.youtube.com/watch?v=<id>
+func canonicalize(link string) string {
+	u, err := url.Parse("https://" + link)
+	if err != nil || u.Host == "" {
+		return link
+	}
+	host := strings.ToLower(u.Host)
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	watch := func(id string) string {
+		res := youtubeHost + "/watch?v=" + id
+		if u.RawQuery != "" {
+			res += "&" + u.RawQuery
+		}
+		return res
+	}
+	switch host {
+	case "youtu.be", "www.youtu.be":
+		if segments[0] != "" {
+			return watch(segments[0])
+		}
+	case "youtube.com", "www.youtube.com", "m.youtube.com", "music.youtube.com",
+		"youtube-nocookie.com", "www.youtube-nocookie.com":
+		if len(segments) == 2 && segments[1] != "videoseries" {
+			switch segments[0] {
+			case "shorts", "live", "embed", "v":
+				return watch(segments[1])
+			}
+		}
+		res := youtubeHost + path.Clean("/"+u.Path)
+		if u.Path == "" || u.Path == "/" {
+			res = youtubeHost + "/"
+		}
+		if u.RawQuery != "" {
+			res += "?" + u.RawQuery
+		}
+		return res
+	}
+	return link
+}
+
+// stripParams removes query params by name, "prefix*" matches prefix
+func stripParams(link string, names []string) string {
+	base, query, ok := strings.Cut(link, "?")
+	if !ok || len(names) == 0 {
+		return link
+	}
+	kept := make([]string, 0)
+	for _, v := range strings.Split(query, "&") {
+		key, _, _ := strings.Cut(v, "=")
+		if v != "" && !matchParam(key, names) {
+			kept = append(kept, v)
+		}
+	}
+	if len(kept) == 0 {
+		return base
+	}
+	return base + "?" + strings.Join(kept, "&")
+}
+
+func matchParam(key string, names []string) bool {
+	for _, v := range names {
+		if prefix, ok := strings.CutSuffix(v, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if key == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package rewrite
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	var def T
+	for k, v := range map[string]string{
+		"youtu.be/jNQXAC9IVRw":                             "www.youtube.com/watch?v=jNQXAC9IVRw",
+		"youtu.be/jNQXAC9IVRw?si=abc&t=10":                 "www.youtube.com/watch?v=jNQXAC9IVRw&t=10",
+		"m.youtube.com/watch?v=jNQXAC9IVRw&feature=share":  "www.youtube.com/watch?v=jNQXAC9IVRw",
+		"www.youtube.com/shorts/jNQXAC9IVRw?feature=share": "www.youtube.com/watch?v=jNQXAC9IVRw",
+		"music.youtube.com/watch?v=jNQXAC9IVRw&list=RD1":   "www.youtube.com/watch?v=jNQXAC9IVRw&list=RD1",
+		"youtube.com/live/jNQXAC9IVRw":                     "www.youtube.com/watch?v=jNQXAC9IVRw",
+		"www.youtube-nocookie.com/embed/jNQXAC9IVRw":       "www.youtube.com/watch?v=jNQXAC9IVRw",
+		"YouTube.com/@channel/videos":                      "www.youtube.com/@channel/videos",
+		"www.youtube.com/embed/videoseries?list=PL1":       "www.youtube.com/embed/videoseries?list=PL1",
+		"site.com/v?utm_source=a&id=1&utm_medium=b":        "site.com/v?id=1",
+		"site.com/v?utm_source=a":                          "site.com/v",
+		"site.com/youtu.be/x":                              "site.com/youtu.be/x",
+	} {
+		if r := def.Apply(k); r != v {
+			t.Error("For", k, "expected", v, "got", r)
+		}
+	}
+}
+
+func TestConfig(t *testing.T) {
+	var r T
+	if err := json.Unmarshal([]byte(`{
+		"rules": [{"match": "^old\\.site\\.com/(.*)$", "replace": "new.site.com/$1"}],
+		"canonicalize": false,
+		"strip-params": ["ref"]
+	}`), &r); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string]string{
+		"old.site.com/v?ref=1&si=2": "new.site.com/v?si=2",
+		"youtu.be/jNQXAC9IVRw":      "youtu.be/jNQXAC9IVRw",
+	} {
+		if res := r.Apply(k); res != v {
+			t.Error("For", k, "expected", v, "got", res)
+		}
+	}
+	if err := json.Unmarshal([]byte(`{"rules": [{"match": "("}]}`), &r); err == nil {
+		t.Error("Expected error for bad regex")
+	}
+}
@@ -0,0 +1,145 @@
+// Package routes expands config defined short routes
+// like "/yt/{id}" into source links
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var paramRe = regexp.MustCompile(`\{([A-Za-z0-9_]+)\}`)
+
+// builtin are first path segments of app routes, templates under them are never reached
+var builtin = []string{"play", "hls", "playlist", "search", "feed", "info", "thumb",
+	"subs", "sign", "admin", "dlna"}
+
+// T is list of route templates,
+// config value is {"<template>": "<link>" or {"url": "<link>", "vh": .., "vf": ..}}
+type T struct {
+	list []routeT
+}
+
+type routeT struct {
+	template string
+	re       *regexp.Regexp
+	link     string
+	height   uint64
+	format   string
+}
+
+type routeConfigT struct {
+	URL    string `json:"url"`
+	Height uint64 `json:"vh"`
+	Format string `json:"vf"`
+}
+
+// UnmarshalJSON is custom json unmarshal func, do not use directly
+func (t *T) UnmarshalJSON(b []byte) error {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	t.list = make([]routeT, 0, len(m))
+	for k, v := range m {
+		var c routeConfigT
+		if err := json.Unmarshal(v, &c.URL); err != nil {
+			if err := json.Unmarshal(v, &c); err != nil {
+				return fmt.Errorf("route %s: %s", k, err)
+			}
+		}
+		r, err := newRoute(k, c)
+		if err != nil {
+			return err
+		}
+		t.list = append(t.list, r)
+	}
+	// longest templates first, so more specific ones win
+	sort.Slice(t.list, func(i, j int) bool {
+		if len(t.list[i].template) != len(t.list[j].template) {
+			return len(t.list[i].template) > len(t.list[j].template)
+		}
+		return t.list[i].template < t.list[j].template
+	})
+	return nil
+}
+
+func newRoute(template string, c routeConfigT) (routeT, error) {
+	if !strings.HasPrefix(template, "/") {
+		return routeT{}, fmt.Errorf("route %s: must start with /", template)
+	}
+	first, _, _ := strings.Cut(template[1:], "/")
+	for _, v := range builtin {
+		if first == v {
+			return routeT{}, fmt.Errorf("route %s: /%s is built-in route", template, v)
+		}
+	}
+	if c.URL == "" {
+		return routeT{}, fmt.Errorf("route %s: empty url", template)
+	}
+	if c.Format != "" && c.Format != "mp4" && c.Format != "m4a" {
+		return routeT{}, fmt.Errorf("route %s: vf must be mp4 or m4a", template)
+	}
+	params := make(map[string]bool)
+	var b strings.Builder
+	b.WriteString("^")
+	last := 0
+	for _, v := range paramRe.FindAllStringSubmatchIndex(template, -1) {
+		name := template[v[2]:v[3]]
+		if params[name] {
+			return routeT{}, fmt.Errorf("route %s: duplicate parameter %s", template, name)
+		}
+		params[name] = true
+		b.WriteString(regexp.QuoteMeta(template[last:v[0]]))
+		fmt.Fprintf(&b, "(?P<%s>[^/]+)", name)
+		last = v[1]
+	}
+	b.WriteString(regexp.QuoteMeta(template[last:]))
+	b.WriteString("$")
+	for _, v := range paramRe.FindAllStringSubmatch(c.URL, -1) {
+		if !params[v[1]] {
+			return routeT{}, fmt.Errorf("route %s: unknown parameter %s in url", template, v[1])
+		}
+	}
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return routeT{}, fmt.Errorf("route %s: %s", template, err)
+	}
+	return routeT{
+		template: template,
+		re:       re,
+		link:     c.URL,
+		height:   c.Height,
+		format:   c.Format,
+	}, nil
+}
+
+// Expand returns "/play?u=<link>&<options>" request uri and matched template
+// for u matching any template, request options override route defaults
+func (t T) Expand(u *url.URL) (string, string, bool) {
+	for _, r := range t.list {
+		m := r.re.FindStringSubmatch(u.Path)
+		if m == nil {
+			continue
+		}
+		link := paramRe.ReplaceAllStringFunc(r.link, func(p string) string {
+			return m[r.re.SubexpIndex(p[1:len(p)-1])]
+		})
+		opts := url.Values{}
+		if r.height != 0 {
+			opts.Set("vh", fmt.Sprintf("%d", r.height))
+		}
+		if r.format != "" {
+			opts.Set("vf", r.format)
+		}
+		for k, v := range u.Query() {
+			opts[k] = v
+		}
+		opts.Set("u", link)
+		return "/play?" + opts.Encode(), r.template, true
+	}
+	return "", "", false
+}
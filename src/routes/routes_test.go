@@ -0,0 +1,57 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	var r T
+	if err := json.Unmarshal([]byte(`{
+		"/yt/{id}": "www.youtube.com/watch?v={id}",
+		"/tw/{channel}": {"url": "twitch.tv/{channel}", "vh": 480, "vf": "m4a"},
+		"/yt/live/{id}": "www.youtube.com/live/{id}"
+	}`), &r); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []struct {
+		uri      string
+		want     string
+		template string
+	}{
+		{"/yt/abc", "/play?u=www.youtube.com%2Fwatch%3Fv%3Dabc", "/yt/{id}"},
+		{"/yt/abc?vh=360", "/play?u=www.youtube.com%2Fwatch%3Fv%3Dabc&vh=360", "/yt/{id}"},
+		{"/yt/live/x", "/play?u=www.youtube.com%2Flive%2Fx", "/yt/live/{id}"},
+		{"/tw/name", "/play?u=twitch.tv%2Fname&vf=m4a&vh=480", "/tw/{channel}"},
+		{"/tw/name?vf=mp4", "/play?u=twitch.tv%2Fname&vf=mp4&vh=480", "/tw/{channel}"},
+		{"/yt/a/b", "", ""},
+		{"/yt/", "", ""},
+		{"/other", "", ""},
+	} {
+		u, _ := url.Parse(v.uri)
+		res, template, ok := r.Expand(u)
+		if ok != (v.want != "") || res != v.want || template != v.template {
+			t.Error("For", v.uri, "expected", v.want, v.template, "got", res, template, ok)
+		}
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	for _, v := range []string{
+		`{"yt/{id}": "site.com/{id}"}`,
+		`{"/yt/{id}": ""}`,
+		`{"/yt/{id}": "site.com/{other}"}`,
+		`{"/yt/{id}/{id}": "site.com/{id}"}`,
+		`{"/yt/{id}": {"url": "site.com/{id}", "vf": "avi"}}`,
+		`{"/yt/{id}": 1}`,
+		`{"/play/{id}": "site.com/{id}"}`,
+		`{"/info": "site.com/v"}`,
+		`{"/admin/{id}": "site.com/{id}"}`,
+	} {
+		var r T
+		if err := json.Unmarshal([]byte(v), &r); err == nil {
+			t.Error("For", v, "expected error")
+		}
+	}
+}
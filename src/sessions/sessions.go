@@ -0,0 +1,173 @@
+// Package sessions contains active /play/ sessions registry
+package sessions
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// rateWindow is throughput measurement window
+const rateWindow = time.Second
+
+// InfoT is session status
+type InfoT struct {
+	ID         uint64    `json:"id"`
+	Client     string    `json:"client"`
+	SubConfig  string    `json:"sub-config"`
+	URL        string    `json:"url"`
+	Height     string    `json:"height"`
+	Format     string    `json:"format"`
+	CacheHit   bool      `json:"cache-hit"`
+	Start      time.Time `json:"start"`
+	Bytes      int64     `json:"bytes"`
+	Throughput float64   `json:"throughput"`
+}
+
+// T is sessions registry, nil T does not track anything
+type T struct {
+	mu   sync.Mutex
+	next uint64
+	list map[uint64]*SessionT
+}
+
+// SessionT is active session
+type SessionT struct {
+	registry *T
+	cancel   context.CancelFunc
+	mu       sync.Mutex
+	info     InfoT
+	// throughput window
+	windowStart time.Time
+	windowBytes int64
+	rate        float64
+}
+
+// New creates sessions registry
+func New() *T {
+	return &T{list: make(map[uint64]*SessionT)}
+}
+
+// Start registers session, cancel stops it on kill
+func (t *T) Start(info InfoT, cancel context.CancelFunc) *SessionT {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.next++
+	info.ID = t.next
+	if info.Start.IsZero() {
+		info.Start = time.Now()
+	}
+	s := &SessionT{registry: t, cancel: cancel, info: info, windowStart: info.Start}
+	t.list[info.ID] = s
+	return s
+}
+
+// List returns sessions ordered by start
+func (t *T) List(now time.Time) []InfoT {
+	res := make([]InfoT, 0)
+	if t == nil {
+		return res
+	}
+	t.mu.Lock()
+	for _, v := range t.list {
+		res = append(res, v.status(now))
+	}
+	t.mu.Unlock()
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID < res[j].ID
+	})
+	return res
+}
+
+// Kill cancels session, returns false if it is not found
+func (t *T) Kill(id uint64) bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	s, ok := t.list[id]
+	t.mu.Unlock()
+	if ok {
+		s.cancel()
+	}
+	return ok
+}
+
+// SetCacheHit sets if link was cached
+func (t *SessionT) SetCacheHit(hit bool) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.info.CacheHit = hit
+	t.mu.Unlock()
+}
+
+// End removes session from registry
+func (t *SessionT) End() {
+	if t == nil {
+		return
+	}
+	t.registry.mu.Lock()
+	delete(t.registry.list, t.info.ID)
+	t.registry.mu.Unlock()
+}
+
+// Writer returns w counting bytes sent
+func (t *SessionT) Writer(w http.ResponseWriter) http.ResponseWriter {
+	if t == nil {
+		return w
+	}
+	return &writerT{ResponseWriter: w, session: t}
+}
+
+func (t *SessionT) add(n int, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.info.Bytes += int64(n)
+	if elapsed := now.Sub(t.windowStart); elapsed >= rateWindow {
+		t.rate = float64(t.info.Bytes-t.windowBytes) / elapsed.Seconds()
+		t.windowStart, t.windowBytes = now, t.info.Bytes
+	}
+}
+
+// status returns session info, throughput is bytes per second
+// of last window, or of current one if it is longer (stalled stream)
+func (t *SessionT) status(now time.Time) InfoT {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	res := t.info
+	res.Throughput = t.rate
+	if elapsed := now.Sub(t.windowStart); elapsed >= 2*rateWindow {
+		res.Throughput = float64(t.info.Bytes-t.windowBytes) / elapsed.Seconds()
+	}
+	return res
+}
+
+type writerT struct {
+	http.ResponseWriter
+	session *SessionT
+}
+
+func (t *writerT) Write(b []byte) (int, error) {
+	n, err := t.ResponseWriter.Write(b)
+	t.session.add(n, time.Now())
+	return n, err
+}
+
+// Flush implements http.Flusher
+func (t *writerT) Flush() {
+	if f, ok := t.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns original writer for http.ResponseController
+func (t *writerT) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
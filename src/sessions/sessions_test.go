@@ -0,0 +1,43 @@
+package sessions
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	r := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	start := time.Now()
+	a := r.Start(InfoT{Client: "a", Start: start}, cancel)
+	b := r.Start(InfoT{Client: "b"}, func() {})
+	a.SetCacheHit(true)
+	w := a.Writer(httptest.NewRecorder())
+	if _, err := w.Write(make([]byte, 100)); err != nil {
+		t.Fatal(err)
+	}
+	a.add(100, start.Add(2*time.Second))
+	list := r.List(start.Add(2 * time.Second))
+	if len(list) != 2 || list[0].Client != "a" || list[1].Client != "b" {
+		t.Fatal("unexpected list", list)
+	}
+	if s := list[0]; !s.CacheHit || s.Bytes != 200 || s.Throughput != 100 {
+		t.Error("unexpected session", s)
+	}
+	if s := r.List(start.Add(6 * time.Second))[0]; s.Throughput != 0 {
+		t.Error("expected stalled throughput, got", s.Throughput)
+	}
+	if !r.Kill(list[0].ID) || ctx.Err() == nil {
+		t.Error("expected killed session")
+	}
+	b.End()
+	if r.Kill(list[1].ID) || len(r.List(time.Now())) != 1 {
+		t.Error("expected ended session removed")
+	}
+	var none *T
+	if s := none.Start(InfoT{}, cancel); s != nil || len(none.List(time.Now())) != 0 {
+		t.Error("expected nil registry")
+	}
+}
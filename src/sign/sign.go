@@ -0,0 +1,120 @@
+// Package sign contains HMAC signed expiring links
+package sign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const minKeyLength = 16
+
+// ConfigT is signing config
+type ConfigT struct {
+	Keys       *[]string `json:"keys"`
+	KeysEnv    *string   `json:"keys-env"`
+	Required   *bool     `json:"required"`
+	ExpireTime *string   `json:"expire-time"`
+}
+
+// T signs and verifies links.
+// First key signs, all keys verify, so keys can be rotated
+type T struct {
+	keys       [][]byte
+	required   bool
+	expireTime time.Duration
+}
+
+// New creates signer, keys from environment variable (comma separated)
+// go before config keys. Returns nil if there are no keys
+func New(conf ConfigT) (*T, error) {
+	var t T
+	if *conf.KeysEnv != "" {
+		for _, v := range strings.Split(os.Getenv(*conf.KeysEnv), ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				t.keys = append(t.keys, []byte(v))
+			}
+		}
+	}
+	for _, v := range *conf.Keys {
+		t.keys = append(t.keys, []byte(v))
+	}
+	for _, v := range t.keys {
+		if len(v) < minKeyLength {
+			return nil, fmt.Errorf("signing key is shorter than %d characters", minKeyLength)
+		}
+	}
+	if len(t.keys) == 0 {
+		if *conf.Required {
+			return nil, fmt.Errorf("signed links required, but no signing keys set")
+		}
+		return nil, nil
+	}
+	var err error
+	if t.expireTime, err = time.ParseDuration(*conf.ExpireTime); err != nil {
+		return nil, fmt.Errorf("signing expire-time: %s", err)
+	}
+	t.required = *conf.Required
+	return &t, nil
+}
+
+// Required tells if unsigned links are rejected
+func (t *T) Required() bool {
+	return t != nil && t.required
+}
+
+// ExpireTime is default signed links lifetime
+func (t *T) ExpireTime() time.Duration {
+	if t == nil {
+		return 0
+	}
+	return t.expireTime
+}
+
+// Sign returns signature and expiry option values of route link with options
+func (t *T) Sign(route string, link string, options url.Values,
+	exp time.Time) (string, string) {
+	e := strconv.FormatInt(exp.Unix(), 10)
+	return mac(t.keys[0], route, link, options, e), e
+}
+
+// Verify checks route link with options signature and expiry
+func (t *T) Verify(route string, link string, options url.Values, sig string, exp string,
+	now time.Time) error {
+	if t == nil {
+		return fmt.Errorf("signing is not configured")
+	}
+	if sig == "" || exp == "" {
+		return fmt.Errorf("missing signature")
+	}
+	e, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid expiry %q", exp)
+	}
+	valid := false
+	for _, v := range t.keys {
+		if hmac.Equal([]byte(mac(v, route, link, options, exp)), []byte(sig)) {
+			valid = true
+		}
+	}
+	if !valid {
+		return fmt.Errorf("invalid signature")
+	}
+	if now.Unix() > e {
+		return fmt.Errorf("link expired at %s", time.Unix(e, 0).Format(time.RFC3339))
+	}
+	return nil
+}
+
+// mac signs "<exp>\n<route>\n<link>\n<options>", options are sorted by Encode
+func mac(key []byte, route string, link string, options url.Values, exp string) string {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(exp + "\n" + route + "\n" + link + "\n" + options.Encode()))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
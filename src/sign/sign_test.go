@@ -0,0 +1,69 @@
+package sign
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func newSigner(t *testing.T, keys ...string) *T {
+	env := "TEST_SIGNING_KEYS"
+	required := false
+	expire := "1h"
+	s, err := New(ConfigT{Keys: &keys, KeysEnv: &env, Required: &required, ExpireTime: &expire})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	old := newSigner(t, "old-key-0123456789")
+	s := newSigner(t, "new-key-0123456789", "old-key-0123456789")
+	opts := url.Values{"vh": {"360"}, "vf": {"m4a"}}
+	sig, exp := old.Sign("play", "site.com/v", opts, now.Add(time.Hour))
+	for _, v := range []struct {
+		route string
+		link  string
+		opts  url.Values
+		sig   string
+		exp   string
+		now   time.Time
+		ok    bool
+	}{
+		{"play", "site.com/v", url.Values{"vf": {"m4a"}, "vh": {"360"}}, sig, exp, now, true},
+		{"info", "site.com/v", opts, sig, exp, now, false},
+		{"play", "site.com/v", opts, sig, exp, now.Add(2 * time.Hour), false},
+		{"play", "site.com/w", opts, sig, exp, now, false},
+		{"play", "site.com/v", url.Values{"vh": {"2160"}, "vf": {"m4a"}}, sig, exp, now, false},
+		{"play", "site.com/v", url.Values{"vh": {"360"}, "vf": {"m4a"}, "profile": {"x"}}, sig, exp, now, false},
+		{"play", "site.com/v", nil, sig, exp, now, false},
+		{"play", "site.com/v", opts, sig, "1800000000", now, false},
+		{"play", "site.com/v", opts, "", exp, now, false},
+		{"play", "site.com/v", opts, sig, "x", now, false},
+	} {
+		if err := s.Verify(v.route, v.link, v.opts, v.sig, v.exp, v.now); (err == nil) != v.ok {
+			t.Error("For", v, "expected", v.ok, "got", err)
+		}
+	}
+	if newSig, _ := s.Sign("play", "site.com/v", opts, now.Add(time.Hour)); newSig == sig {
+		t.Error("expected first key to sign")
+	}
+}
+
+func TestEnvKeys(t *testing.T) {
+	t.Setenv("TEST_SIGNING_KEYS", "env-key-0123456789, ")
+	s := newSigner(t)
+	if s == nil || len(s.keys) != 1 {
+		t.Fatal("expected env key")
+	}
+	t.Setenv("TEST_SIGNING_KEYS", "short")
+	env := "TEST_SIGNING_KEYS"
+	keys := []string{}
+	fls := false
+	expire := "1h"
+	if _, err := New(ConfigT{Keys: &keys, KeysEnv: &env, Required: &fls, ExpireTime: &expire}); err == nil {
+		t.Error("expected short key error")
+	}
+}
@@ -0,0 +1,149 @@
+// Package sites matches links against sub-configs sites lists.
+//
+// Entry kinds, in precedence order:
+//   - "site.com/live/" exact host with path prefix of whole segments, longer first
+//   - "site.com" exact host
+//   - "*.site.com/live/", "*.site.com" host and any subdomain, longer first
+//   - "re:<regex>" regex on whole link without scheme, in config order
+//
+// Hosts are compared case-insensitively and without port,
+// unless entry has port, paths are case-sensitive. Equal rules are resolved by lists order.
+package sites
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	regexPrefix    = "re:"
+	wildcardPrefix = "*."
+)
+
+type kindT uint8
+
+const (
+	exactPath kindT = iota
+	exact
+	wildcard
+	regex
+)
+
+// IndexT is precompiled sites lists index
+type IndexT struct {
+	rules []ruleT
+}
+
+type ruleT struct {
+	kind  kindT
+	host  string
+	path  string
+	re    *regexp.Regexp
+	raw   string
+	owner int
+}
+
+// New builds index from sites lists, list index is returned by Match
+func New(lists [][]string) (IndexT, error) {
+	var t IndexT
+	for k, list := range lists {
+		for _, v := range list {
+			r, err := newRule(v)
+			if err != nil {
+				return t, err
+			}
+			r.owner = k
+			t.rules = append(t.rules, r)
+		}
+	}
+	sort.SliceStable(t.rules, func(i, j int) bool {
+		a, b := t.rules[i], t.rules[j]
+		if a.kind != b.kind {
+			return a.kind < b.kind
+		}
+		if a.kind == regex {
+			return false
+		}
+		return len(a.host)+len(a.path) > len(b.host)+len(b.path)
+	})
+	return t, nil
+}
+
+func newRule(site string) (ruleT, error) {
+	r := ruleT{raw: site}
+	if strings.HasPrefix(site, regexPrefix) {
+		re, err := regexp.Compile(strings.TrimPrefix(site, regexPrefix))
+		if err != nil {
+			return r, fmt.Errorf("site %q: %s", site, err)
+		}
+		r.kind, r.re = regex, re
+		return r, nil
+	}
+	host, path, hasPath := strings.Cut(site, "/")
+	host = strings.ToLower(host)
+	if host == "" {
+		return r, fmt.Errorf("site %q: empty host", site)
+	}
+	r.kind, r.host = exact, host
+	if strings.HasPrefix(host, wildcardPrefix) {
+		r.kind, r.host = wildcard, strings.TrimPrefix(host, wildcardPrefix)
+	}
+	if hasPath {
+		r.path = "/" + path
+		if r.kind == exact {
+			r.kind = exactPath
+		}
+	}
+	return r, nil
+}
+
+// Match returns list index and matched site entry for link without scheme
+func (t IndexT) Match(link string) (int, string, bool) {
+	u, err := url.Parse("https://" + link)
+	if err != nil {
+		return 0, "", false
+	}
+	host := strings.ToLower(u.Host)
+	hostname := strings.ToLower(u.Hostname())
+	path := u.EscapedPath()
+	for _, r := range t.rules {
+		if r.match(link, host, hostname, path) {
+			return r.owner, r.raw, true
+		}
+	}
+	return 0, "", false
+}
+
+func (r ruleT) match(link, host, hostname, path string) bool {
+	if r.kind == regex {
+		return r.re.MatchString(link)
+	}
+	h := hostname
+	if strings.Contains(r.host, ":") {
+		h = host
+	}
+	switch r.kind {
+	case exact, exactPath:
+		if h != r.host {
+			return false
+		}
+	case wildcard:
+		if h != r.host && !strings.HasSuffix(h, "."+r.host) {
+			return false
+		}
+	}
+	return pathHasPrefix(path, r.path)
+}
+
+// pathHasPrefix checks if prefix is whole path segments of path,
+// so "site.com/live" matches "/live/1" but not "/lively"
+func pathHasPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || prefix == "" ||
+		strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
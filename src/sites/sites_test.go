@@ -0,0 +1,52 @@
+package sites
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	index, err := New([][]string{
+		{"site.com", "re:^video\\.example\\.org/v/[0-9]+$"},
+		{"*.site.com", "localhost:8080"},
+		{"site.com/live/", "*.other.com/live/", "Site.com/Live/", "site.com/tv"},
+		{"other.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []struct {
+		link  string
+		owner int
+		site  string
+		ok    bool
+	}{
+		{"site.com/v/1", 0, "site.com", true},
+		{"Site.com:443/v/1", 0, "site.com", true},
+		{"www.site.com/v/1", 1, "*.site.com", true},
+		{"site.com/live/1", 2, "site.com/live/", true},
+		{"SITE.com/Live/1", 2, "Site.com/Live/", true},
+		{"a.other.com/live/1", 2, "*.other.com/live/", true},
+		{"other.com/live/1", 3, "other.com", true},
+		{"other.com/v/1", 3, "other.com", true},
+		{"localhost:8080/v", 1, "localhost:8080", true},
+		{"localhost/v", 0, "", false},
+		{"video.example.org/v/12", 0, "re:^video\\.example\\.org/v/[0-9]+$", true},
+		{"video.example.org/v/a", 0, "", false},
+		{"notsite.com/v/1", 0, "", false},
+		{"site.com/tv", 2, "site.com/tv", true},
+		{"site.com/tv/1", 2, "site.com/tv", true},
+		{"site.com/tvevil", 0, "site.com", true},
+		{"site.com/livex", 0, "site.com", true},
+	} {
+		owner, site, ok := index.Match(v.link)
+		if owner != v.owner || site != v.site || ok != v.ok {
+			t.Error("For", v.link, "expected", v.owner, v.site, v.ok, "got", owner, site, ok)
+		}
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	for _, v := range []string{"re:(", "/path"} {
+		if _, err := New([][]string{{v}}); err == nil {
+			t.Error("For", v, "expected error")
+		}
+	}
+}
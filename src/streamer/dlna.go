@@ -0,0 +1,52 @@
+package streamer
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	getContentFeaturesHeader = "getcontentFeatures.dlna.org"
+	contentFeaturesHeader    = "contentFeatures.dlna.org"
+	transferModeHeader       = "transferMode.dlna.org"
+	transferModeStreaming    = "Streaming"
+
+	// DLNA.ORG_FLAGS: streaming transfer mode, background transfer mode,
+	// connection stalling and DLNA v1.5
+	dlnaFlags = "01700000000000000000000000000000"
+)
+
+// dlnaProfiles maps content types to DLNA.ORG_PN media profiles
+var dlnaProfiles = map[string]string{
+	"video/mp4":  "AVC_MP4_HP_HD_AAC",
+	"audio/mp4":  "AAC_ISO_320",
+	"video/mp2t": "MPEG_TS_HD_NA_ISO",
+}
+
+// contentFeatures makes contentFeatures.dlna.org header value,
+// byteSeek tells if client can seek with Range requests
+func contentFeatures(contentType string, byteSeek bool) string {
+	op := "00"
+	if byteSeek {
+		op = "01"
+	}
+	res := fmt.Sprintf("DLNA.ORG_OP=%s;DLNA.ORG_CI=0;DLNA.ORG_FLAGS=%s", op, dlnaFlags)
+	mime, _, _ := strings.Cut(contentType, ";")
+	if pn, ok := dlnaProfiles[strings.TrimSpace(mime)]; ok {
+		res = fmt.Sprintf("DLNA.ORG_PN=%s;%s", pn, res)
+	}
+	return res
+}
+
+// setDLNAHeaders answers DLNA clients headers requests,
+// must be called before response headers are written
+func setDLNAHeaders(w http.ResponseWriter, req *http.Request,
+	contentType string, byteSeek bool) {
+	if req.Header.Get(getContentFeaturesHeader) == "1" {
+		w.Header().Set(contentFeaturesHeader, contentFeatures(contentType, byteSeek))
+	}
+	if req.Header.Get(transferModeHeader) != "" {
+		w.Header().Set(transferModeHeader, transferModeStreaming)
+	}
+}
@@ -0,0 +1,110 @@
+package streamer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	cidr "ytproxy/cidr"
+)
+
+// blockedUpstream are loopback, link-local (cloud metadata included),
+// private, shared, multicast and reserved ranges
+var blockedUpstream = func() cidr.ListT {
+	list, err := cidr.Parse([]string{
+		"0.0.0.0/8",
+		"10.0.0.0/8",
+		"100.64.0.0/10",
+		"127.0.0.0/8",
+		"169.254.0.0/16",
+		"172.16.0.0/12",
+		"192.0.0.0/24",
+		"192.168.0.0/16",
+		"198.18.0.0/15",
+		"224.0.0.0/4",
+		"240.0.0.0/4",
+		"::/128",
+		"::1/128",
+		"fc00::/7",
+		"fe80::/10",
+		"ff00::/8",
+	})
+	if err != nil {
+		panic(err)
+	}
+	return list
+}()
+
+// upstreamPolicy blocks internal upstream addresses not in allow list
+type upstreamPolicy struct {
+	allow cidr.ListT
+}
+
+func (t upstreamPolicy) check(ip net.IP) error {
+	if blockedUpstream.Contains(ip) && !t.allow.Contains(ip) {
+		return fmt.Errorf("upstream address %s is not allowed", ip)
+	}
+	return nil
+}
+
+// checkHost resolves host and checks all its addresses
+func (t upstreamPolicy) checkHost(ctx context.Context, host string) error {
+	if ip := net.ParseIP(host); ip != nil {
+		return t.check(ip)
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	for _, v := range addrs {
+		if err := t.check(v.IP); err != nil {
+			return fmt.Errorf("%s: %s", host, err)
+		}
+	}
+	return nil
+}
+
+// control checks address actually dialed, so DNS answer cannot change after check
+func (t upstreamPolicy) control(_, address string, _ syscall.RawConn) error {
+	return t.check(cidr.IP(address))
+}
+
+type proxiedKey struct{}
+
+// guard makes transport check every request, redirect hops included.
+// Direct connections are checked on dial, proxied requests
+// (proxy connects to upstream) by resolved target host
+func (t upstreamPolicy) guard(tr *http.Transport) http.RoundTripper {
+	direct := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second,
+		Control: t.control}
+	proxy := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if proxied, _ := ctx.Value(proxiedKey{}).(bool); proxied {
+			return proxy.DialContext(ctx, network, addr)
+		}
+		return direct.DialContext(ctx, network, addr)
+	}
+	return roundTripF(func(req *http.Request) (*http.Response, error) {
+		if tr.Proxy == nil {
+			return tr.RoundTrip(req)
+		}
+		u, err := tr.Proxy(req)
+		if err != nil || u == nil {
+			return tr.RoundTrip(req)
+		}
+		if err := t.checkHost(req.Context(), req.URL.Hostname()); err != nil {
+			return nil, err
+		}
+		return tr.RoundTrip(req.WithContext(
+			context.WithValue(req.Context(), proxiedKey{}, true)))
+	})
+}
+
+type roundTripF func(*http.Request) (*http.Response, error)
+
+func (f roundTripF) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,88 @@
+package streamer
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	cidr "ytproxy/cidr"
+)
+
+func TestUpstreamCheck(t *testing.T) {
+	allow, err := cidr.Parse([]string{"192.168.1.0/24"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := upstreamPolicy{allow: allow}
+	for _, v := range []struct {
+		ip string
+		ok bool
+	}{
+		{"8.8.8.8", true},
+		{"2a00:1450::1", true},
+		{"127.0.0.1", false},
+		{"169.254.169.254", false},
+		{"10.1.2.3", false},
+		{"::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"fd00:ec2::254", false},
+		{"192.168.1.1", true},
+		{"192.168.2.1", false},
+	} {
+		if err := p.check(net.ParseIP(v.ip)); (err == nil) != v.ok {
+			t.Error("For", v.ip, "expected", v.ok, "got", err)
+		}
+	}
+}
+
+func newTestServer(t *testing.T, addr string, h http.HandlerFunc) *httptest.Server {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Skip("cannot listen", addr, err)
+	}
+	s := httptest.NewUnstartedServer(h)
+	s.Listener = l
+	s.Start()
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestUpstreamGuard(t *testing.T) {
+	target := newTestServer(t, "127.0.0.2:0", func(w http.ResponseWriter, _ *http.Request) {})
+	redirect := newTestServer(t, "127.0.0.1:0", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusFound)
+	})
+	// answers as proxy
+	proxy := newTestServer(t, "127.0.0.1:0", func(w http.ResponseWriter, _ *http.Request) {})
+	proxyURL, _ := url.Parse(proxy.URL)
+	allow, _ := cidr.Parse([]string{"127.0.0.1"})
+	for _, v := range []struct {
+		allow cidr.ListT
+		proxy bool
+		link  string
+		ok    bool
+	}{
+		{nil, false, target.URL, false},
+		{allow, false, redirect.URL, false},
+		{cidr.ListT{}, true, target.URL, false},
+		{append(allow, &net.IPNet{IP: net.ParseIP("127.0.0.2"),
+			Mask: net.CIDRMask(32, 32)}), false, redirect.URL, true},
+		{cidr.ListT{{IP: net.ParseIP("127.0.0.2"),
+			Mask: net.CIDRMask(32, 32)}}, true, target.URL, true},
+	} {
+		tr := &http.Transport{}
+		if v.proxy {
+			tr.Proxy = http.ProxyURL(proxyURL)
+		}
+		client := &http.Client{Transport: upstreamPolicy{allow: v.allow}.guard(tr)}
+		res, err := client.Get(v.link)
+		if err == nil {
+			_ = res.Body.Close()
+		}
+		if (err == nil) != v.ok {
+			t.Error("For", v.allow, v.proxy, v.link, "expected", v.ok, "got", err)
+		}
+	}
+}
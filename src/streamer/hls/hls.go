@@ -0,0 +1,425 @@
+// Package hls implements HLS playlist restreaming as continuous MPEG-TS
+package hls
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	logger "ytproxy/logger"
+)
+
+const (
+	tagHeader         = "#EXTM3U"
+	tagStreamInf      = "#EXT-X-STREAM-INF:"
+	tagTargetDuration = "#EXT-X-TARGETDURATION:"
+	tagMediaSequence  = "#EXT-X-MEDIA-SEQUENCE:"
+	tagKey            = "#EXT-X-KEY:"
+	tagMap            = "#EXT-X-MAP:"
+	tagInf            = "#EXTINF:"
+	tagEndList        = "#EXT-X-ENDLIST"
+
+	methodNone   = "NONE"
+	methodAES128 = "AES-128"
+
+	defaultTargetDuration = 6 * time.Second
+)
+
+// FetchF downloads url content
+type FetchF func(string) ([]byte, error)
+
+// KeyT is segment encryption key description
+type KeyT struct {
+	Method string
+	URI    string
+	IV     []byte
+}
+
+// SegmentT is single media segment
+type SegmentT struct {
+	URI      string
+	Sequence uint64
+	Key      KeyT
+}
+
+// VariantT is master playlist entry
+type VariantT struct {
+	URI       string
+	Bandwidth uint64
+}
+
+// PlaylistT is parsed playlist
+type PlaylistT struct {
+	Variants       []VariantT
+	Segments       []SegmentT
+	TargetDuration time.Duration
+	EndList        bool
+}
+
+// IsMaster reports whether playlist is master (variants) playlist
+func (p PlaylistT) IsMaster() bool {
+	return len(p.Variants) > 0
+}
+
+// IsPlaylist checks if upstream content type or url looks like HLS playlist
+func IsPlaylist(contentType string, rawURL string) bool {
+	ct := strings.ToLower(contentType)
+	if strings.Contains(ct, "mpegurl") {
+		return true
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return strings.HasSuffix(strings.ToLower(u.Path), ".m3u8")
+}
+
+// Parse parses playlist content, relative links are resolved against base
+func Parse(content []byte, base string) (PlaylistT, error) {
+	var (
+		p        PlaylistT
+		key      = KeyT{Method: methodNone}
+		seq      uint64
+		inf      bool
+		variant  *VariantT
+		checked  bool
+		baseURL  *url.URL
+		parseErr error
+	)
+	baseURL, parseErr = url.Parse(base)
+	if parseErr != nil {
+		return p, parseErr
+	}
+	resolve := func(ref string) (string, error) {
+		u, err := url.Parse(ref)
+		if err != nil {
+			return "", err
+		}
+		return baseURL.ResolveReference(u).String(), nil
+	}
+	p.TargetDuration = defaultTargetDuration
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !checked {
+			if line != tagHeader {
+				return p, fmt.Errorf("not a HLS playlist")
+			}
+			checked = true
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, tagStreamInf):
+			attrs := parseAttributes(strings.TrimPrefix(line, tagStreamInf))
+			bw, _ := strconv.ParseUint(attrs["BANDWIDTH"], 10, 64)
+			variant = &VariantT{Bandwidth: bw}
+		case strings.HasPrefix(line, tagTargetDuration):
+			d, err := strconv.ParseFloat(strings.TrimPrefix(line, tagTargetDuration), 64)
+			if err == nil && d > 0 {
+				p.TargetDuration = time.Duration(d * float64(time.Second))
+			}
+		case strings.HasPrefix(line, tagMediaSequence):
+			s, err := strconv.ParseUint(strings.TrimPrefix(line, tagMediaSequence), 10, 64)
+			if err != nil {
+				return p, fmt.Errorf("bad media sequence: %s", err)
+			}
+			seq = s
+		case strings.HasPrefix(line, tagKey):
+			attrs := parseAttributes(strings.TrimPrefix(line, tagKey))
+			k := KeyT{Method: attrs["METHOD"]}
+			switch k.Method {
+			case methodNone:
+			case methodAES128:
+				uri, err := resolve(attrs["URI"])
+				if err != nil {
+					return p, fmt.Errorf("bad key uri: %s", err)
+				}
+				k.URI = uri
+				if iv, ok := attrs["IV"]; ok {
+					k.IV, err = parseIV(iv)
+					if err != nil {
+						return p, err
+					}
+				}
+			default:
+				return p, fmt.Errorf("unsupported encryption method %q", k.Method)
+			}
+			key = k
+		case strings.HasPrefix(line, tagMap):
+			return p, fmt.Errorf("fMP4 segments are not supported")
+		case strings.HasPrefix(line, tagInf):
+			inf = true
+		case line == tagEndList:
+			p.EndList = true
+		case strings.HasPrefix(line, "#"):
+		default:
+			uri, err := resolve(line)
+			if err != nil {
+				return p, fmt.Errorf("bad uri: %s", err)
+			}
+			switch {
+			case variant != nil:
+				variant.URI = uri
+				p.Variants = append(p.Variants, *variant)
+				variant = nil
+			case inf:
+				p.Segments = append(p.Segments,
+					SegmentT{URI: uri, Sequence: seq, Key: key})
+				seq++
+				inf = false
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return p, err
+	}
+	if !checked {
+		return p, fmt.Errorf("empty playlist")
+	}
+	return p, nil
+}
+
+func parseAttributes(s string) map[string]string {
+	res := make(map[string]string)
+	for len(s) > 0 {
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			break
+		}
+		name := strings.TrimSpace(s[:eq])
+		s = s[eq+1:]
+		var value string
+		if strings.HasPrefix(s, "\"") {
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				value, s = s[1:], ""
+			} else {
+				value, s = s[1:end+1], s[end+2:]
+			}
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				value, s = s, ""
+			} else {
+				value, s = s[:end], s[end:]
+			}
+		}
+		res[name] = value
+		s = strings.TrimPrefix(s, ",")
+	}
+	return res
+}
+
+func parseIV(s string) ([]byte, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	iv, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("bad IV: %s", err)
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("bad IV length %d", len(iv))
+	}
+	return iv, nil
+}
+
+func sequenceIV(seq uint64) []byte {
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint64(iv[aes.BlockSize-8:], seq)
+	return iv
+}
+
+func decrypt(data, key, iv []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("encrypted segment size %d is not multiple of block size",
+			len(data))
+	}
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(data, data)
+	if l := len(data); l > 0 {
+		pad := int(data[l-1])
+		if pad > 0 && pad <= aes.BlockSize && pad <= l {
+			data = data[:l-pad]
+		}
+	}
+	return data, nil
+}
+
+type bridge struct {
+	fetch  FetchF
+	keys   map[string][]byte
+	log    logger.T
+	buffer int
+}
+
+type chunkT struct {
+	data []byte
+	err  error
+}
+
+// Stream restreams playlist segments to w as continuous MPEG-TS.
+// Live playlists are polled until stream ends or w fails.
+func Stream(w io.Writer, playlistURL string, content []byte, fetch FetchF,
+	buffer int, log logger.T) error {
+	if buffer < 1 {
+		buffer = 1
+	}
+	b := bridge{
+		fetch:  fetch,
+		keys:   make(map[string][]byte),
+		log:    log,
+		buffer: buffer,
+	}
+	p, err := Parse(content, playlistURL)
+	if err != nil {
+		return err
+	}
+	if p.IsMaster() {
+		v := selectVariant(p.Variants)
+		log.LogDebug("HLS variant selected", "url", v.URI, "bandwidth", v.Bandwidth)
+		playlistURL = v.URI
+		if p, err = b.playlist(playlistURL); err != nil {
+			return err
+		}
+		if p.IsMaster() {
+			return fmt.Errorf("nested master playlist")
+		}
+	}
+	chunks := make(chan chunkT, buffer)
+	done := make(chan struct{})
+	defer close(done)
+	go b.produce(p, playlistURL, chunks, done)
+	for c := range chunks {
+		if c.err != nil {
+			return c.err
+		}
+		if _, err := w.Write(c.data); err != nil {
+			return err
+		}
+		if f, ok := w.(interface{ Flush() }); ok {
+			f.Flush()
+		}
+	}
+	return nil
+}
+
+func selectVariant(list []VariantT) VariantT {
+	best := list[0]
+	for _, v := range list[1:] {
+		if v.Bandwidth > best.Bandwidth {
+			best = v
+		}
+	}
+	return best
+}
+
+func (b *bridge) playlist(u string) (PlaylistT, error) {
+	content, err := b.fetch(u)
+	if err != nil {
+		return PlaylistT{}, fmt.Errorf("playlist download: %s", err)
+	}
+	return Parse(content, u)
+}
+
+func (b *bridge) produce(p PlaylistT, playlistURL string, chunks chan<- chunkT,
+	done <-chan struct{}) {
+	defer close(chunks)
+	send := func(c chunkT) bool {
+		select {
+		case chunks <- c:
+			return true
+		case <-done:
+			return false
+		}
+	}
+	var (
+		last    uint64
+		started bool
+	)
+	segments := p.Segments
+	if !p.EndList && len(segments) > b.buffer {
+		// live stream, start near live edge
+		segments = segments[len(segments)-b.buffer:]
+	}
+	for {
+		fresh := 0
+		for _, s := range segments {
+			if started && s.Sequence <= last {
+				continue
+			}
+			data, err := b.segment(s)
+			if err != nil {
+				send(chunkT{err: err})
+				return
+			}
+			if !send(chunkT{data: data}) {
+				return
+			}
+			last, started = s.Sequence, true
+			fresh++
+		}
+		if p.EndList {
+			return
+		}
+		wait := p.TargetDuration
+		if fresh > 0 {
+			wait /= 2
+		}
+		b.log.LogDebug("HLS live playlist", "new segments", fresh,
+			"last sequence", last, "next poll", wait)
+		select {
+		case <-time.After(wait):
+		case <-done:
+			return
+		}
+		var err error
+		if p, err = b.playlist(playlistURL); err != nil {
+			send(chunkT{err: err})
+			return
+		}
+		segments = p.Segments
+	}
+}
+
+func (b *bridge) segment(s SegmentT) ([]byte, error) {
+	data, err := b.fetch(s.URI)
+	if err != nil {
+		return nil, fmt.Errorf("segment %d download: %s", s.Sequence, err)
+	}
+	if s.Key.Method != methodAES128 {
+		return data, nil
+	}
+	key, ok := b.keys[s.Key.URI]
+	if !ok {
+		if key, err = b.fetch(s.Key.URI); err != nil {
+			return nil, fmt.Errorf("key download: %s", err)
+		}
+		if len(key) != aes.BlockSize {
+			return nil, fmt.Errorf("bad key length %d", len(key))
+		}
+		b.keys[s.Key.URI] = key
+	}
+	iv := s.Key.IV
+	if iv == nil {
+		iv = sequenceIV(s.Sequence)
+	}
+	data, err = decrypt(data, key, iv)
+	if err != nil {
+		return nil, fmt.Errorf("segment %d decrypt: %s", s.Sequence, err)
+	}
+	return data, nil
+}
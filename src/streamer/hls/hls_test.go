@@ -0,0 +1,137 @@
+package hls
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"testing"
+
+	logger_empty "ytproxy/logger/impl/empty"
+)
+
+func TestParseMedia(t *testing.T) {
+	content := []byte(`#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXT-X-MEDIA-SEQUENCE:10
+#EXTINF:4.0,
+seg10.ts
+#EXT-X-KEY:METHOD=AES-128,URI="key.bin",IV=0x000102030405060708090a0b0c0d0e0f
+#EXTINF:4.0,
+/abs/seg11.ts
+#EXT-X-KEY:METHOD=NONE
+#EXTINF:4.0,
+http://other.example/seg12.ts
+#EXT-X-ENDLIST
+`)
+	p, err := Parse(content, "http://host.example/live/index.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.IsMaster() || !p.EndList || p.TargetDuration.Seconds() != 4 {
+		t.Fatal("bad playlist", p)
+	}
+	for k, v := range []struct {
+		uri    string
+		seq    uint64
+		method string
+		key    string
+	}{
+		{uri: "http://host.example/live/seg10.ts", seq: 10, method: "NONE"},
+		{uri: "http://host.example/abs/seg11.ts", seq: 11, method: "AES-128",
+			key: "http://host.example/live/key.bin"},
+		{uri: "http://other.example/seg12.ts", seq: 12, method: "NONE"},
+	} {
+		s := p.Segments[k]
+		if s.URI != v.uri || s.Sequence != v.seq || s.Key.Method != v.method || s.Key.URI != v.key {
+			t.Error("For", k, "expected", v, "got", s)
+		}
+	}
+	if len(p.Segments[1].Key.IV) != aes.BlockSize || p.Segments[1].Key.IV[15] != 0x0f {
+		t.Error("bad IV", p.Segments[1].Key.IV)
+	}
+}
+
+func TestParseMaster(t *testing.T) {
+	content := []byte(`#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360,CODECS="avc1.4d401e,mp4a.40.2"
+360.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=2500000,RESOLUTION=1280x720
+720.m3u8
+`)
+	p, err := Parse(content, "http://host.example/master.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.IsMaster() || len(p.Variants) != 2 {
+		t.Fatal("bad master playlist", p)
+	}
+	if v := selectVariant(p.Variants); v.URI != "http://host.example/720.m3u8" {
+		t.Error("expected 720 variant, got", v)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, v := range []string{
+		"",
+		"not a playlist",
+		"#EXTM3U\n#EXT-X-KEY:METHOD=SAMPLE-AES,URI=\"k\"\n",
+		"#EXTM3U\n#EXT-X-MAP:URI=\"init.mp4\"\n",
+		"#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"k\",IV=0x01\n",
+	} {
+		if _, err := Parse([]byte(v), "http://host.example/"); err == nil {
+			t.Error("For", v, "expected error")
+		}
+	}
+}
+
+func TestIsPlaylist(t *testing.T) {
+	for _, v := range []struct {
+		ct   string
+		url  string
+		want bool
+	}{
+		{ct: "application/vnd.apple.mpegurl", url: "http://a/b", want: true},
+		{ct: "audio/x-mpegURL", url: "http://a/b", want: true},
+		{ct: "", url: "http://a/b/index.m3u8?token=1", want: true},
+		{ct: "video/mp4", url: "http://a/b.mp4", want: false},
+	} {
+		if r := IsPlaylist(v.ct, v.url); r != v.want {
+			t.Error("For", v.ct, v.url, "expected", v.want, "got", r)
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	plain := []byte("second segment, encrypted")
+	padded := append([]byte{}, plain...)
+	pad := aes.BlockSize - len(padded)%aes.BlockSize
+	padded = append(padded, bytes.Repeat([]byte{byte(pad)}, pad)...)
+	block, _ := aes.NewCipher(key)
+	encrypted := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, sequenceIV(1)).CryptBlocks(encrypted, padded)
+	files := map[string][]byte{
+		"http://h/seg0.ts": []byte("first segment|"),
+		"http://h/seg1.ts": encrypted,
+		"http://h/key":     key,
+	}
+	playlist := []byte(`#EXTM3U
+#EXTINF:1,
+seg0.ts
+#EXT-X-KEY:METHOD=AES-128,URI="key"
+#EXTINF:1,
+seg1.ts
+#EXT-X-ENDLIST
+`)
+	log, _ := logger_empty.New()
+	var out bytes.Buffer
+	err := Stream(&out, "http://h/index.m3u8", playlist, func(u string) ([]byte, error) {
+		return append([]byte{}, files[u]...), nil
+	}, 2, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "first segment|" + string(plain); out.String() != want {
+		t.Error("expected", want, "got", out.String())
+	}
+}
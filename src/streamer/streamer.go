@@ -12,11 +12,18 @@ import (
 	"os"
 	"strings"
 
+	cidr "ytproxy/cidr"
 	extractor "ytproxy/extractor"
+	limiter "ytproxy/limiter"
 	logger "ytproxy/logger"
+	hls "ytproxy/streamer/hls"
 )
 
-const defaultErrorHeader = "Error-Header-"
+const (
+	defaultErrorHeader = "Error-Header-"
+	hlsContentType     = "video/mp2t"
+	maxDownloadSize    = 32 << 20
+)
 
 // ConfigT is restreamer config
 type ConfigT struct {
@@ -29,6 +36,14 @@ type ConfigT struct {
 	UserAgent            *string        `json:"user-agent"`
 	Proxy                *string        `json:"proxy"`
 	MinTLSVersion        *TLSVersion    `json:"min-tls-version"`
+	HLSToTS              *bool          `json:"hls-to-ts"`
+	HLSBuffer            *uint64        `json:"hls-buffer"`
+	DLNAHeaders          *bool          `json:"dlna-headers"`
+	// ClientBandwidth is KiB/s of every client, ClientBandwidthBurst is KiB
+	ClientBandwidth      *uint64 `json:"client-bandwidth"`
+	ClientBandwidthBurst *uint64 `json:"client-bandwidth-burst"`
+	// AllowUpstream opens blocked internal ranges for upstream requests
+	AllowUpstream *cidr.ListT `json:"allow-upstream"`
 }
 
 // TLSVersion selects restreamer minimal supported TLS version
@@ -92,7 +107,8 @@ func (u *setUserAgentT) UnmarshalJSON(b []byte) error {
 // T is restreamer interface
 type T interface {
 	Play(http.ResponseWriter, *http.Request, extractor.ResultT, logger.T) error
-	PlayError(http.ResponseWriter, extractor.RequestT, error) error
+	PlayError(http.ResponseWriter, *http.Request, extractor.RequestT, error) error
+	Fetch(*http.Request, string, string) (*http.Response, error)
 }
 
 type streamer struct {
@@ -102,6 +118,12 @@ type streamer struct {
 	sendErrorFile        sendErrorFileF
 	setHeaders           func(http.ResponseWriter, *http.Response) error
 	setStreamerUserAgent func(*http.Request) string
+	hlsToTS              bool
+	hlsBuffer            int
+	dlnaHeaders          bool
+	shaper               *limiter.ShaperT
+	clientBandwidth      uint64
+	clientBandwidthBurst uint64
 }
 
 type (
@@ -115,8 +137,9 @@ type fileT struct {
 	contentLength int64
 }
 
-// New creates restreamer implementation
-func New(conf ConfigT, log logger.T, xt extractor.T) (T, error) {
+// New creates restreamer implementation,
+// shaper is shared by all restreamers
+func New(conf ConfigT, log logger.T, xt extractor.T, shaper *limiter.ShaperT) (T, error) {
 	var (
 		s    streamer
 		err  error
@@ -141,6 +164,19 @@ func New(conf ConfigT, log logger.T, xt extractor.T) (T, error) {
 	}
 	s.sendErrorFile = makeSendErrorVideoFunc(conf)
 	s.setHeaders = makeSetHeaders(conf)
+	s.hlsToTS = *conf.HLSToTS
+	s.hlsBuffer = int(*conf.HLSBuffer)
+	if s.hlsToTS {
+		log.LogDebug("streamer", "hls-to-ts", true, "hls-buffer", s.hlsBuffer)
+	}
+	s.dlnaHeaders = *conf.DLNAHeaders
+	s.shaper = shaper
+	s.clientBandwidth = *conf.ClientBandwidth
+	s.clientBandwidthBurst = *conf.ClientBandwidthBurst
+	if s.clientBandwidth > 0 {
+		log.LogDebug("streamer", "client-bandwidth", s.clientBandwidth,
+			"client-bandwidth-burst", s.clientBandwidthBurst)
+	}
 	s.setStreamerUserAgent, err = makeSetStreamerUserAgent(conf, xt, log)
 	if err != nil {
 		return &s, err
@@ -154,15 +190,11 @@ func (t *streamer) Play(
 	resT extractor.ResultT,
 	log logger.T,
 ) error {
-	request, err := http.NewRequest("GET", resT.URL, nil)
-	if err != nil {
-		return err
-	}
+	var rng string
 	if r1, ok := req.Header["Range"]; ok {
-		request.Header.Set("Range", r1[0])
+		rng = r1[0]
 	}
-	request.Header.Set("User-Agent", t.setStreamerUserAgent(req))
-	res, err := t.httpRequest(request)
+	res, err := t.Fetch(req, resT.URL, rng)
 	if err != nil {
 		return err
 	}
@@ -172,25 +204,108 @@ func (t *streamer) Play(
 		}
 	}()
 	log.LogDebug("streamer", "response", res)
+	if t.hlsToTS && hls.IsPlaylist(res.Header.Get("Content-Type"), resT.URL) {
+		return t.playHLS(w, req, res, log)
+	}
+	if t.dlnaHeaders {
+		setDLNAHeaders(w, req, res.Header.Get("Content-Type"),
+			res.Header.Get("Accept-Ranges") == "bytes" ||
+				res.StatusCode == http.StatusPartialContent)
+	}
 	err = t.setHeaders(w, res)
 	if err != nil {
 		return err
 	}
-	_, err = io.Copy(w, res.Body)
+	_, err = io.Copy(t.shape(w, req), res.Body)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (t *streamer) PlayError(w http.ResponseWriter, req extractor.RequestT,
-	err error) error {
+func (t *streamer) playHLS(
+	w http.ResponseWriter,
+	req *http.Request,
+	res *http.Response,
+	log logger.T,
+) error {
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("playlist request failed: %s", res.Status)
+	}
+	content, err := readBody(res.Body)
+	if err != nil {
+		return err
+	}
+	fetch := func(u string) ([]byte, error) {
+		res, err := t.Fetch(req, u, "")
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err := res.Body.Close(); err != nil {
+				log.LogError("body close", "error", err)
+			}
+		}()
+		if res.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s: %s", u, res.Status)
+		}
+		return readBody(res.Body)
+	}
+	w.Header().Set("Content-Type", hlsContentType)
+	if t.dlnaHeaders {
+		setDLNAHeaders(w, req, hlsContentType, false)
+	}
+	log.LogDebug("streamer", "hls-to-ts", res.Request.URL)
+	return hls.Stream(t.shape(w, req), res.Request.URL.String(), content, fetch, t.hlsBuffer, log)
+}
+
+// shape limits client output bandwidth
+func (t *streamer) shape(w io.Writer, req *http.Request) io.Writer {
+	client := req.RemoteAddr
+	if ip := cidr.IP(req.RemoteAddr); ip != nil {
+		client = ip.String()
+	}
+	return t.shaper.Writer(req.Context(), w, client,
+		t.clientBandwidth, t.clientBandwidthBurst)
+}
+
+// Fetch requests url through streamer transport,
+// rng is optional Range header value.
+// Request is canceled with client request context
+func (t *streamer) Fetch(req *http.Request, u string, rng string) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(req.Context(), "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if rng != "" {
+		request.Header.Set("Range", rng)
+	}
+	request.Header.Set("User-Agent", t.setStreamerUserAgent(req))
+	return t.httpRequest(request)
+}
+
+func readBody(r io.Reader) ([]byte, error) {
+	b, err := io.ReadAll(io.LimitReader(r, maxDownloadSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxDownloadSize {
+		return nil, fmt.Errorf("response body is larger than %d bytes", maxDownloadSize)
+	}
+	return b, nil
+}
+
+func (t *streamer) PlayError(w http.ResponseWriter, r *http.Request,
+	req extractor.RequestT, err error) error {
 	var file *fileT
 	if req.FORMAT == "mp4" {
 		file = &t.errorVideoFile
 	} else {
 		file = &t.errorAudioFile
 	}
+	if t.dlnaHeaders {
+		setDLNAHeaders(w, r, file.contentType, false)
+	}
 	return t.sendErrorFile(w, err, *file)
 }
 
@@ -265,8 +380,12 @@ func makeDoRequestFunc(conf ConfigT) (doRequestF, []string, error) {
 		}
 		tr.Proxy = http.ProxyURL(u)
 	}
+	if len(*conf.AllowUpstream) > 0 {
+		logs = append(logs, fmt.Sprintf("upstream allowed ranges: %s", *conf.AllowUpstream))
+	}
+	rt := upstreamPolicy{allow: *conf.AllowUpstream}.guard(tr)
 	return func(request *http.Request) (*http.Response, error) {
-		client := &http.Client{Transport: tr}
+		client := &http.Client{Transport: rt}
 		return client.Do(request)
 	}, logs, nil
 }
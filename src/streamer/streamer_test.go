@@ -24,3 +24,19 @@ func TestErrorToHeaders(t *testing.T) {
 		}
 	}
 }
+
+func TestContentFeatures(t *testing.T) {
+	for _, v := range []struct {
+		contentType string
+		byteSeek    bool
+		want        string
+	}{
+		{"video/mp4", true, "DLNA.ORG_PN=AVC_MP4_HP_HD_AAC;DLNA.ORG_OP=01;DLNA.ORG_CI=0;DLNA.ORG_FLAGS=" + dlnaFlags},
+		{"audio/mp4; charset=binary", false, "DLNA.ORG_PN=AAC_ISO_320;DLNA.ORG_OP=00;DLNA.ORG_CI=0;DLNA.ORG_FLAGS=" + dlnaFlags},
+		{"application/octet-stream", true, "DLNA.ORG_OP=01;DLNA.ORG_CI=0;DLNA.ORG_FLAGS=" + dlnaFlags},
+	} {
+		if res := contentFeatures(v.contentType, v.byteSeek); res != v.want {
+			t.Errorf("For %s expected %q, got %q", v.contentType, v.want, res)
+		}
+	}
+}
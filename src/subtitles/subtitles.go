@@ -0,0 +1,177 @@
+// Package subtitles converts WebVTT subtitles to SRT
+package subtitles
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	vttHeader = "WEBVTT"
+	arrow     = "-->"
+)
+
+var tagRe = regexp.MustCompile(`<[^>]*>`)
+
+type cueT struct {
+	start time.Duration
+	end   time.Duration
+	lines []string
+}
+
+// VTTToSRT converts WebVTT to SRT.
+// Cue settings, styles and tags are dropped, lines repeated from
+// previous cue (rolling auto captions) are removed.
+func VTTToSRT(data []byte) ([]byte, error) {
+	cues, err := parseVTT(data)
+	if err != nil {
+		return nil, err
+	}
+	cues = dedupe(cues)
+	var b bytes.Buffer
+	for k, v := range cues {
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", k+1,
+			srtTime(v.start), srtTime(v.end), strings.Join(v.lines, "\n"))
+	}
+	return b.Bytes(), nil
+}
+
+func parseVTT(data []byte) ([]cueT, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	blocks := make([][]string, 0)
+	block := make([]string, 0)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			if len(block) > 0 {
+				blocks = append(blocks, block)
+				block = make([]string, 0)
+			}
+			continue
+		}
+		block = append(block, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(block) > 0 {
+		blocks = append(blocks, block)
+	}
+	if len(blocks) == 0 || !strings.HasPrefix(blocks[0][0], vttHeader) {
+		return nil, fmt.Errorf("not a WebVTT file")
+	}
+	cues := make([]cueT, 0, len(blocks))
+	for _, v := range blocks[1:] {
+		// cue identifier is optional
+		if !strings.Contains(v[0], arrow) {
+			v = v[1:]
+		}
+		if len(v) == 0 || !strings.Contains(v[0], arrow) {
+			// NOTE, STYLE, REGION blocks
+			continue
+		}
+		c, err := parseTiming(v[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range v[1:] {
+			if l = cleanLine(l); l != "" {
+				c.lines = append(c.lines, l)
+			}
+		}
+		if len(c.lines) > 0 {
+			cues = append(cues, c)
+		}
+	}
+	return cues, nil
+}
+
+func parseTiming(s string) (cueT, error) {
+	parts := strings.SplitN(s, arrow, 2)
+	start, err := parseTime(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return cueT{}, err
+	}
+	// end time is followed by optional cue settings
+	fields := strings.Fields(parts[1])
+	if len(fields) == 0 {
+		return cueT{}, fmt.Errorf("bad cue timing %q", s)
+	}
+	end, err := parseTime(fields[0])
+	if err != nil {
+		return cueT{}, err
+	}
+	return cueT{start: start, end: end}, nil
+}
+
+// parseTime parses "hh:mm:ss.ttt" or "mm:ss.ttt"
+func parseTime(s string) (time.Duration, error) {
+	bad := fmt.Errorf("bad timestamp %q", s)
+	main, frac, ok := strings.Cut(s, ".")
+	if !ok || len(frac) != 3 {
+		return 0, bad
+	}
+	ms, err := strconv.Atoi(frac)
+	if err != nil {
+		return 0, bad
+	}
+	var res time.Duration
+	for _, v := range strings.Split(main, ":") {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, bad
+		}
+		res = res*60 + time.Duration(n)
+	}
+	return res*time.Second + time.Duration(ms)*time.Millisecond, nil
+}
+
+func srtTime(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d,%03d",
+		ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+func cleanLine(s string) string {
+	s = tagRe.ReplaceAllString(s, "")
+	s = strings.ReplaceAll(s, "&nbsp;", " ")
+	s = html.UnescapeString(s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// dedupe removes lines already shown by previous cue
+// and cues left without text
+func dedupe(cues []cueT) []cueT {
+	res := make([]cueT, 0, len(cues))
+	var prev []string
+	for _, c := range cues {
+		lines := c.lines
+		for len(lines) > 0 && contains(prev, lines[0]) {
+			lines = lines[1:]
+		}
+		prev = c.lines
+		if len(lines) == 0 {
+			continue
+		}
+		c.lines = lines
+		res = append(res, c)
+	}
+	return res
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
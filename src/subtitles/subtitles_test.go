@@ -0,0 +1,54 @@
+package subtitles
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVTTToSRT(t *testing.T) {
+	vtt := "\xef\xbb\xbfWEBVTT\r\nKind: captions\r\nLanguage: en\r\n\r\n" +
+		"STYLE\n::cue { color: white }\n\n" +
+		"NOTE this is a comment\n\n" +
+		"1\n00:00:01.000 --> 00:00:02.500 align:start position:0%\n<i>Hello</i> &amp; welcome\n\n" +
+		"00:02.500 --> 00:04.000\nsecond   line\n\n" +
+		// auto captions repeat previous line and add new one
+		"00:00:04.000 --> 00:00:04.010\nsecond line\n\n" +
+		"00:00:04.010 --> 00:00:06.000\nsecond line\nthird<00:00:04.500><c> word</c>\n\n" +
+		"01:00:00.000 --> 01:00:01.001\nlast\n"
+	want := "1\n00:00:01,000 --> 00:00:02,500\nHello & welcome\n\n" +
+		"2\n00:00:02,500 --> 00:00:04,000\nsecond line\n\n" +
+		"3\n00:00:04,010 --> 00:00:06,000\nthird word\n\n" +
+		"4\n01:00:00,000 --> 01:00:01,001\nlast\n\n"
+	out, err := VTTToSRT([]byte(vtt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != want {
+		t.Errorf("expected\n%q\ngot\n%q", want, out)
+	}
+}
+
+func TestVTTToSRTErrors(t *testing.T) {
+	for _, v := range []string{
+		"",
+		"1\n00:00:01.000 --> 00:00:02.000\ntext\n",
+		"WEBVTT\n\n00:00:01 --> 00:00:02.000\ntext\n",
+		"WEBVTT\n\n00:00:01.000 -->\ntext\n",
+	} {
+		if _, err := VTTToSRT([]byte(v)); err == nil {
+			t.Error("For", v, "expected error")
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	for k, v := range map[string]time.Duration{
+		"00:00.001":    time.Millisecond,
+		"01:02.003":    time.Minute + 2*time.Second + 3*time.Millisecond,
+		"10:01:02.003": 10*time.Hour + time.Minute + 2*time.Second + 3*time.Millisecond,
+	} {
+		if r, err := parseTime(k); err != nil || r != v {
+			t.Error("For", k, "expected", v, "got", r, err)
+		}
+	}
+}
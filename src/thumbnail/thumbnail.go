@@ -0,0 +1,84 @@
+// Package thumbnail converts images to downscaled JPEG
+package thumbnail
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	_ "image/png" // png decoder
+)
+
+const (
+	quality   = 85
+	maxPixels = 64 << 20
+)
+
+// ContentType is converted image content type
+const ContentType = "image/jpeg"
+
+// Convert decodes JPEG or PNG image, downscales it to width
+// (0 or bigger than image width means keep size) and encodes it as JPEG
+func Convert(data []byte, width int) ([]byte, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("image decode: %s", err)
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, fmt.Errorf("image is too big: %dx%d", cfg.Width, cfg.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("image decode: %s", err)
+	}
+	if width > 0 && width < img.Bounds().Dx() {
+		img = resize(img, width)
+	}
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// resize downscales image to width keeping aspect ratio,
+// every destination pixel is average of source pixels it covers
+func resize(img image.Image, width int) image.Image {
+	sb := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, sb.Dx(), sb.Dy()))
+	draw.Draw(src, src.Bounds(), img, sb.Min, draw.Src)
+	sw, sh := sb.Dx(), sb.Dy()
+	height := sh * width / sw
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*sh/height, (y+1)*sh/height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0, x1 := x*sw/width, (x+1)*sw/width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint64(p[0])
+					g += uint64(p[1])
+					b += uint64(p[2])
+					a += uint64(p[3])
+					n++
+				}
+			}
+			d := dst.Pix[y*dst.Stride+x*4:]
+			d[0], d[1], d[2], d[3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,55 @@
+package thumbnail
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestResize(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		img.Set(x, 0, color.RGBA{R: 200, A: 255})
+		img.Set(x, 1, color.RGBA{R: 100, A: 255})
+	}
+	r := resize(img, 2).(*image.RGBA)
+	if b := r.Bounds(); b.Dx() != 2 || b.Dy() != 1 {
+		t.Fatal("expected 2x1, got", b)
+	}
+	if c := r.RGBAAt(1, 0); c.R != 150 || c.A != 255 {
+		t.Error("expected averaged pixel, got", c)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	var src bytes.Buffer
+	if err := png.Encode(&src, image.NewRGBA(image.Rect(0, 0, 640, 360))); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []struct {
+		width int
+		want  image.Point
+	}{
+		{width: 0, want: image.Pt(640, 360)},
+		{width: 320, want: image.Pt(320, 180)},
+		{width: 1000, want: image.Pt(640, 360)},
+	} {
+		out, err := Convert(src.Bytes(), v.width)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(out))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := image.Pt(cfg.Width, cfg.Height); got != v.want {
+			t.Error("For", v.width, "expected", v.want, "got", got)
+		}
+	}
+	if _, err := Convert([]byte("not an image"), 0); err == nil {
+		t.Error("expected error")
+	}
+}